@@ -0,0 +1,280 @@
+// Package bully elects the live node with the highest identifier among a static set of peers with the bully algorithm
+// it needs no coordination service, the nodes talk to each other over a transport.Transport
+package bully
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/leadership"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/peers"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/transport"
+)
+
+const (
+	// DefaultAnswerTimeout is the answer timeout used when AnswerTimeout is not set
+	DefaultAnswerTimeout = time.Second
+	// DefaultCoordinatorTimeout is the coordinator timeout used when CoordinatorTimeout is not set
+	DefaultCoordinatorTimeout = 2 * time.Second
+	// DefaultHeartbeatInterval is the heartbeat interval used when HeartbeatInterval is not set
+	DefaultHeartbeatInterval = time.Second
+	// DefaultLeaderTimeout is the leader timeout used when LeaderTimeout is not set
+	DefaultLeaderTimeout = 3 * time.Second
+)
+
+// the kinds of the messages of the algorithm
+const (
+	// electionMessage is sent to the nodes with a higher identifier when a node starts an election
+	electionMessage = "election"
+	// answerMessage is the answer of a higher node to an election message, it tells the candidate to stand down
+	answerMessage = "answer"
+	// coordinatorMessage announces the leader to every node, the leader sends it again on every heartbeat
+	coordinatorMessage = "coordinator"
+)
+
+// payload is the content of every message
+type payload struct {
+	// Term is the highest term known by the sender
+	Term int64 `json:"term"`
+}
+
+// phase is the step of the algorithm the node is in
+type phase int
+
+const (
+	// electing means the node has sent election messages and is waiting for an answer
+	electing phase = iota
+	// awaitingCoordinator means a higher node answered and the node is waiting for the coordinator message
+	awaitingCoordinator
+	// following means the node knows the leader and is waiting for its heartbeats
+	following
+	// leading means the node is the leader
+	leading
+)
+
+// Node is a node of a bully election
+// It publishes the same states and runs the same callbacks as election.LeaderElection
+type Node struct {
+	// Transport carries the messages of the node, its identifier is the identifier of the node
+	Transport transport.Transport
+	// Peers are the identifiers of the other nodes, the node itself is ignored if it is listed
+	Peers []int
+	// AnswerTimeout is how long a candidate waits for a higher node to answer before declaring itself the leader
+	// The default value is DefaultAnswerTimeout
+	AnswerTimeout time.Duration
+	// CoordinatorTimeout is how long a candidate that was answered waits for the new leader to announce itself before starting a new election
+	// The default value is DefaultCoordinatorTimeout
+	CoordinatorTimeout time.Duration
+	// HeartbeatInterval is the time between two announcements of the leader
+	// It must be smaller than LeaderTimeout. The default value is DefaultHeartbeatInterval
+	HeartbeatInterval time.Duration
+	// LeaderTimeout is how long a follower waits for an announcement of the leader before starting an election
+	// The default value is DefaultLeaderTimeout
+	LeaderTimeout time.Duration
+	// Loop holds the logger, the callbacks, the context of the election loop and the published state
+	election.Loop
+	// leader is the leader known by the node
+	leader peers.Leader
+	// term is the highest term known by the node, the fencing token of a leader is the term it was elected in
+	// the terms only grow with the elections the node has heard of, so a node that restarts without hearing from the others may start over from a lower term
+	term int64
+	// phase is the step of the algorithm the node is in
+	phase phase
+	// timer fires at the deadline of the current phase
+	timer *time.Timer
+}
+
+// defaultConfig initializes the recommended default values for the node
+func (n *Node) defaultConfig() {
+	if n.AnswerTimeout == 0 {
+		n.AnswerTimeout = DefaultAnswerTimeout
+	}
+	if n.CoordinatorTimeout == 0 {
+		n.CoordinatorTimeout = DefaultCoordinatorTimeout
+	}
+	if n.HeartbeatInterval == 0 {
+		n.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if n.LeaderTimeout == 0 {
+		n.LeaderTimeout = DefaultLeaderTimeout
+	}
+	if n.Log == nil {
+		n.Log = &log.Logger
+	}
+}
+
+func (n *Node) validateConfig() error {
+	if n.Transport == nil {
+		return fmt.Errorf("no transport provided")
+	}
+	if n.AnswerTimeout <= 0 || n.CoordinatorTimeout <= 0 {
+		return fmt.Errorf("answer and coordinator timeouts must be positive")
+	}
+	if n.HeartbeatInterval <= 0 || n.LeaderTimeout <= n.HeartbeatInterval {
+		return fmt.Errorf("timeouts must verify 0 < heartbeat interval < leader timeout")
+	}
+	return nil
+}
+
+// ID returns the identifier of the node
+func (n *Node) ID() int {
+	return n.Transport.ID()
+}
+
+// Leader returns the identifier of the leader known by the node, false if the node does not know it
+func (n *Node) Leader() (int, bool) {
+	return n.leader.Get()
+}
+
+// Run takes part in the election until ctx is done or the transport is closed
+// it blocks the calling goroutine and returns an error when the configuration is invalid or the transport is closed
+func (n *Node) Run(ctx context.Context) error {
+	n.defaultConfig()
+	err := n.validateConfig()
+	if err != nil {
+		return err
+	}
+	defer leadership.Start(&n.Loop, ctx)()
+	defer n.leader.Set(0, false)
+	n.timer = time.NewTimer(n.LeaderTimeout)
+	defer n.timer.Stop()
+	n.startElection()
+	for {
+		select {
+		case <-n.Ctx.Done():
+			n.Log.Info().Msg("Context cancelled. Exiting")
+			return nil
+		case msg, ok := <-n.Transport.Messages():
+			if !ok {
+				n.Log.Info().Msg("Transport closed. Exiting")
+				return transport.ErrClosed
+			}
+			n.handle(msg)
+		case <-n.timer.C:
+			n.timeout()
+		}
+	}
+}
+
+// enter moves the node to the given phase, which ends after the given duration
+func (n *Node) enter(phase phase, deadline time.Duration) {
+	n.phase = phase
+	peers.ResetTimer(n.timer, deadline)
+}
+
+// startElection sends an election message to every higher node, the node becomes the leader right away if there is none
+func (n *Node) startElection() {
+	n.leader.Set(0, false)
+	leadership.SetState(&n.Loop, election.Candidate)
+	higher := 0
+	for _, peer := range n.Peers {
+		if peer > n.ID() {
+			higher++
+			n.send(peer, electionMessage)
+		}
+	}
+	if higher == 0 {
+		n.lead()
+		return
+	}
+	n.Log.Info().Msgf("Starting an election among %d higher nodes", higher)
+	n.enter(electing, n.AnswerTimeout)
+}
+
+// lead makes the node the leader of a new term and announces it to every node
+func (n *Node) lead() {
+	n.term++
+	n.leader.Set(n.ID(), true)
+	leadership.Lead(&n.Loop, n.term)
+	n.broadcast(coordinatorMessage)
+	n.enter(leading, n.HeartbeatInterval)
+}
+
+// follow makes the node follow the given leader until it stops announcing itself
+func (n *Node) follow(leader int) {
+	current, known := n.Leader()
+	if n.phase != following || !known || current != leader {
+		n.Log.Info().Msgf("Following node %d", leader)
+	}
+	n.leader.Set(leader, true)
+	leadership.SetState(&n.Loop, election.Follower)
+	n.enter(following, n.LeaderTimeout)
+}
+
+// timeout moves the node forward when the deadline of its phase is reached
+func (n *Node) timeout() {
+	switch n.phase {
+	case electing:
+		n.Log.Info().Msg("No higher node answered, taking the leadership")
+		n.lead()
+	case awaitingCoordinator:
+		n.Log.Info().Msg("The new leader did not announce itself, starting a new election")
+		n.startElection()
+	case following:
+		leader, _ := n.Leader()
+		n.Log.Info().Msgf("Leader %d timed out, starting an election", leader)
+		n.startElection()
+	case leading:
+		n.broadcast(coordinatorMessage)
+		n.enter(leading, n.HeartbeatInterval)
+	}
+}
+
+// handle processes a message from a peer
+func (n *Node) handle(msg transport.Message) {
+	var content payload
+	err := msg.Decode(&content)
+	if err != nil {
+		n.Log.Info().Err(err).Msgf("Ignoring invalid %s message from node %d", msg.Kind, msg.From)
+		return
+	}
+	if content.Term > n.term {
+		n.term = content.Term
+	}
+	switch msg.Kind {
+	case electionMessage:
+		if msg.From > n.ID() {
+			return
+		}
+		n.send(msg.From, answerMessage)
+		// a follower does not start an election of its own: its leader is higher than the lower node, so it gets the election message too and announces itself
+		// a candidate is already running one
+		if n.phase == leading {
+			// the lower node missed the announcement, there is no need for a new election
+			n.send(msg.From, coordinatorMessage)
+		}
+	case answerMessage:
+		if n.phase == electing {
+			n.enter(awaitingCoordinator, n.CoordinatorTimeout)
+		}
+	case coordinatorMessage:
+		if msg.From > n.ID() {
+			n.follow(msg.From)
+			return
+		}
+		// a lower node claims the leadership, it is bullied by this one
+		if n.phase == leading {
+			n.send(msg.From, coordinatorMessage)
+			return
+		}
+		if n.phase == following {
+			n.startElection()
+		}
+	}
+}
+
+// send sends a message of the given kind to the peer in the background, the failures are left to the timeouts of the algorithm
+func (n *Node) send(to int, kind string) {
+	peers.Send(n.Ctx, n.Log, n.Transport, n.AnswerTimeout, to, kind, payload{Term: n.term})
+}
+
+// broadcast sends a message of the given kind to every peer
+func (n *Node) broadcast(kind string) {
+	for _, peer := range peers.Others(n.ID(), n.Peers) {
+		n.send(peer, kind)
+	}
+}
@@ -0,0 +1,24 @@
+package bully_test
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestBully(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Bully Suite")
+}
+
+// freeAddress returns a local address on a port that is free at the time of the call
+func freeAddress() string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
@@ -0,0 +1,134 @@
+package bully_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/bully"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/peertest"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/transport"
+)
+
+var peers = []int{1, 2, 3, 4}
+
+// newNode returns a node with short timeouts on the given transport
+func newNode(node transport.Transport, peers []int) *bully.Node {
+	return &bully.Node{
+		Transport:          node,
+		Peers:              peers,
+		AnswerTimeout:      100 * time.Millisecond,
+		CoordinatorTimeout: 300 * time.Millisecond,
+		HeartbeatInterval:  50 * time.Millisecond,
+		LeaderTimeout:      250 * time.Millisecond,
+	}
+}
+
+var _ = Describe("Bully election on an in-memory network", func() {
+	var (
+		ctx     context.Context
+		cancel  context.CancelFunc
+		cluster *peertest.Cluster[*bully.Node]
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		cluster = peertest.NewCluster(ctx, func(memory transport.Transport) *bully.Node {
+			return newNode(memory, peers)
+		})
+	})
+	AfterEach(func() {
+		cancel()
+		cluster.Close()
+	})
+
+	It("must elect the node with the highest identifier", func() {
+		cluster.Start(peers...)
+		cluster.ExpectLeader(4)
+		Consistently(cluster.Nodes[4].IsLeader, 500*time.Millisecond).Should(BeTrue())
+		for _, id := range []int{1, 2, 3} {
+			Expect(cluster.Nodes[id].IsLeader()).To(BeFalse())
+		}
+	})
+
+	It("must elect the next highest node with a bigger token when the leader crashes", func() {
+		cluster.Start(peers...)
+		cluster.ExpectLeader(4)
+		firstToken, ok := cluster.Nodes[4].FencingToken()
+		Expect(ok).To(BeTrue())
+		cluster.Crash(4)
+		cluster.ExpectLeader(3)
+		secondToken, ok := cluster.Nodes[3].FencingToken()
+		Expect(ok).To(BeTrue())
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+	})
+
+	It("must hand the leadership back to a higher node that comes back", func() {
+		revoked := make(chan struct{}, 1)
+		cluster.Join(1, 2, 3)
+		cluster.Nodes[3].OnRevoked = func() {
+			revoked <- struct{}{}
+		}
+		cluster.Run(1, 2, 3)
+		cluster.ExpectLeader(3)
+		cluster.Start(4)
+		cluster.ExpectLeader(4)
+		Expect(revoked).To(Receive())
+	})
+
+	It("must converge on the highest node once a partition heals", func() {
+		cluster.Start(peers...)
+		cluster.ExpectLeader(4)
+		cluster.Network.Partition([]int{4})
+		// the bully algorithm has no quorum, so each side of the partition elects its own leader
+		Eventually(peertest.LeaderOf(cluster.Nodes[1])).Should(Equal(3))
+		Eventually(cluster.Nodes[3].IsLeader).Should(BeTrue())
+		Expect(cluster.Nodes[4].IsLeader()).To(BeTrue())
+		cluster.Network.Heal()
+		cluster.ExpectLeader(4)
+	})
+
+	It("must become the leader right away when it is alone", func() {
+		cluster.Join(1)
+		node := cluster.Nodes[1]
+		node.Peers = nil
+		cluster.Run(1)
+		Expect(node.WaitForLeadership(ctx)).To(Succeed())
+		leader, ok := node.Leader()
+		Expect(ok).To(BeTrue())
+		Expect(leader).To(Equal(1))
+	})
+
+	It("must refuse an invalid configuration", func() {
+		cluster.Join(1)
+		node := cluster.Nodes[1]
+		node.LeaderTimeout = node.HeartbeatInterval
+		Expect(node.Run(ctx)).NotTo(Succeed())
+		Expect((&bully.Node{}).Run(ctx)).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("Bully election over TCP", func() {
+	It("must elect the node with the highest identifier and fail over", func() {
+		addresses := map[int]string{1: freeAddress(), 2: freeAddress(), 3: freeAddress()}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		nodes := map[int]*bully.Node{}
+		for id := range addresses {
+			tcp, err := transport.NewTCP(transport.TCPConfig{ID: id, Peers: addresses, DialTimeout: 100 * time.Millisecond})
+			Expect(err).To(BeNil())
+			defer tcp.Close()
+			nodes[id] = newNode(tcp, []int{1, 2, 3})
+			go nodes[id].Run(ctx)
+		}
+		for _, node := range nodes {
+			Eventually(peertest.LeaderOf(node)).Should(Equal(3))
+		}
+		Expect(nodes[3].IsLeader()).To(BeTrue())
+		nodes[3].Transport.Close()
+		Eventually(nodes[2].IsLeader).Should(BeTrue())
+		Eventually(peertest.LeaderOf(nodes[1])).Should(Equal(2))
+	})
+})
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+)
+
+const (
+	// DefaultKillTimeout is how long the child process has to exit after SIGTERM before it is killed
+	DefaultKillTimeout = 10 * time.Second
+	// DefaultRestartDelay is the minimum time between two starts of the child process on the same node
+	DefaultRestartDelay = 5 * time.Second
+)
+
+// errChildExited is returned by the leader function when the child process exits on its own, so that the node resigns
+var errChildExited = errors.New("child process exited")
+
+// leaderExecCommand parses the flags of the leader-exec command, runs it until SIGINT or SIGTERM and returns the exit code
+func leaderExecCommand(args []string) int {
+	flags := flag.NewFlagSet("leader-exec", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: dalgo leader-exec --namespace <path> [flags] -- <command> [args...]")
+		flags.PrintDefaults()
+	}
+	zookeepers := flags.String("zk", "127.0.0.1:2181", "comma separated list of the zookeeper servers")
+	namespace := flags.String("namespace", "", "namespace of the election, e.g. /jobs/my-cron")
+	id := flags.String("id", "", "identifier of the candidate, the hostname by default")
+	sessionTimeout := flags.Duration("session-timeout", election.DefaultZkTimeout, "zookeeper session timeout")
+	killTimeout := flags.Duration("kill-timeout", DefaultKillTimeout, "how long the command has to exit after SIGTERM before it is killed")
+	restartDelay := flags.Duration("restart-delay", DefaultRestartDelay, "minimum time between two starts of the command on this node")
+	createNamespace := flags.Bool("create-namespace", false, "create the namespace if it does not exist")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	command := flags.Args()
+	if *namespace == "" || len(command) == 0 {
+		flags.Usage()
+		return 2
+	}
+	// a missing binary will not appear by resigning and starting it again
+	_, err = exec.LookPath(command[0])
+	if err != nil {
+		log.Error().Err(err).Msg("Command not found")
+		return 1
+	}
+	opts := []election.Option{
+		election.WithTimeout(*sessionTimeout),
+		election.WithID(*id),
+	}
+	if *createNamespace {
+		opts = append(opts, election.WithCreateNamespace(election.PersistentNamespace))
+	}
+	leaderElection, err := election.New(strings.Split(*zookeepers, ","), *namespace, opts...)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid election configuration")
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = leaderExec(ctx, leaderElection, command, *killTimeout, *restartDelay)
+	if err != nil {
+		log.Error().Err(err).Msg("Election failed")
+		return 1
+	}
+	return 0
+}
+
+// leaderExec runs the election and runs the command every time the node becomes the leader, until ctx is done
+// the command is stopped when the leadership is lost, and the node resigns when the command exits on its own
+// a node does not start the command again before restartDelay has passed since its last start, so a command that keeps crashing does not respawn in a tight loop
+// the node resigns right away though, so another candidate takes over without waiting for the delay
+// it returns once the command has exited and the election loop has stopped
+func leaderExec(ctx context.Context, leaderElection *election.LeaderElection, command []string, killTimeout, restartDelay time.Duration) error {
+	// the election is stopped with Stop rather than with ctx so that the next instance takes over without waiting for the session to expire
+	runCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	run := make(chan error, 1)
+	go func() {
+		run <- leaderElection.Run(runCtx)
+	}()
+	// it returns when ctx is done or when the election loop exits on its own, in both cases once the command has exited
+	var lastStart time.Time
+	leaderElection.RunWhileLeader(ctx, func(leaderCtx context.Context) error {
+		wait := time.Until(lastStart.Add(restartDelay))
+		if wait > 0 {
+			leaderElection.Log.Info().Dur("wait", wait).Msg("The command started recently, waiting before starting it again")
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-leaderCtx.Done():
+				return nil
+			case <-timer.C:
+			}
+		}
+		lastStart = time.Now()
+		return runChild(leaderCtx, leaderElection.Log, command, killTimeout)
+	})
+	stopCtx, stop := context.WithTimeout(context.Background(), leaderElection.ZkTimeout)
+	defer stop()
+	err := leaderElection.Stop(stopCtx)
+	if err != nil && !errors.Is(err, election.ErrNotRunning) {
+		leaderElection.Log.Info().Err(err).Msg("Failed to stop the election")
+	}
+	cancel()
+	return <-run
+}
+
+// runChild runs the command until it exits or leaderCtx is done
+// when leaderCtx is done the command gets SIGTERM, and it is killed if it has not exited after killTimeout
+// it returns errChildExited if the command exits on its own, whatever its exit status
+func runChild(leaderCtx context.Context, logger *zerolog.Logger, command []string, killTimeout time.Duration) error {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+	logger.Info().Int("pid", cmd.Process.Pid).Msg("Started the command")
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+	select {
+	case err = <-exited:
+		if err != nil {
+			return fmt.Errorf("%w: %v", errChildExited, err)
+		}
+		return errChildExited
+	case <-leaderCtx.Done():
+	}
+	logger.Info().Int("pid", cmd.Process.Pid).Msg("Leadership lost, terminating the command")
+	cmd.Process.Signal(syscall.SIGTERM)
+	timer := time.NewTimer(killTimeout)
+	defer timer.Stop()
+	select {
+	case <-exited:
+		return nil
+	case <-timer.C:
+	}
+	logger.Info().Int("pid", cmd.Process.Pid).Dur("killTimeout", killTimeout).Msg("The command did not exit after SIGTERM, killing it")
+	cmd.Process.Kill()
+	<-exited
+	return nil
+}
@@ -0,0 +1,118 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/memory"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+)
+
+const (
+	// graceful appends start to the file given as $0, and term once it gets SIGTERM
+	graceful = `trap 'echo term >> "$0"; exit 0' TERM; echo start >> "$0"; while :; do sleep 0.05; done`
+	// stubborn appends start to the file given as $0 and ignores SIGTERM
+	stubborn = `trap '' TERM; echo start >> "$0"; while :; do sleep 0.05; done`
+	// crashing appends start to the file given as $0 and exits right away
+	crashing = `echo start >> "$0"; exit 1`
+)
+
+var _ = Describe("leader-exec on the in-memory backend", func() {
+	var (
+		store      *memory.Store
+		dir        string
+		ctx        context.Context
+		cancel     context.CancelFunc
+		candidates []*election.LeaderElection
+	)
+
+	// start runs leader-exec with the script for a new candidate
+	// it returns the candidate, the file in which the script writes its events and the result of leaderExec
+	start := func(script string, killTimeout, restartDelay time.Duration) (*election.LeaderElection, string, chan error) {
+		id := fmt.Sprintf("candidate-%d", len(candidates))
+		candidate, err := election.New(nil, "/jobs/test",
+			election.WithBackend(store),
+			election.WithCreateNamespace(election.PersistentNamespace),
+			election.WithBackoff(backoff.NewConstantBackOff(10*time.Millisecond)),
+			election.WithID(id),
+		)
+		Expect(err).To(BeNil())
+		candidates = append(candidates, candidate)
+		events, done := filepath.Join(dir, id), make(chan error, 1)
+		go func() {
+			done <- leaderExec(ctx, candidate, []string{"sh", "-c", script, events}, killTimeout, restartDelay)
+		}()
+		Eventually(candidate.State).Should(BeElementOf(election.Leader, election.Follower))
+		return candidate, events, done
+	}
+	// events returns a function that returns the events written by a script
+	events := func(path string) func() []string {
+		return func() []string {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil
+			}
+			return strings.Fields(string(data))
+		}
+	}
+
+	BeforeEach(func() {
+		candidates = nil
+		store = memory.New()
+		dir = GinkgoT().TempDir()
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+	AfterEach(func() {
+		cancel()
+		for _, candidate := range candidates {
+			Eventually(candidate.State, 5*time.Second).Should(Equal(election.Stopped))
+		}
+	})
+
+	It("must run the command only on the leader and terminate it when the leadership moves", func() {
+		first, firstEvents, _ := start(graceful, time.Second, time.Second)
+		Eventually(events(firstEvents)).Should(Equal([]string{"start"}))
+		second, secondEvents, _ := start(graceful, time.Second, time.Second)
+		Consistently(events(secondEvents), 300*time.Millisecond).Should(BeEmpty())
+		Expect(first.Resign(ctx, election.Rejoin)).To(Succeed())
+		Eventually(events(firstEvents)).Should(Equal([]string{"start", "term"}))
+		Eventually(events(secondEvents)).Should(Equal([]string{"start"}))
+		Expect(second.IsLeader()).To(BeTrue())
+	})
+
+	It("must kill the command when it ignores SIGTERM for longer than the kill timeout", func() {
+		_, stubbornEvents, done := start(stubborn, 300*time.Millisecond, time.Second)
+		Eventually(events(stubbornEvents)).Should(Equal([]string{"start"}))
+		stopped := time.Now()
+		cancel()
+		Eventually(done, 3*time.Second).Should(Receive(BeNil()))
+		Expect(time.Since(stopped)).To(BeNumerically(">=", 300*time.Millisecond))
+	})
+
+	It("must resign when the command exits so that another candidate takes over", func() {
+		_, crashingEvents, _ := start(crashing, time.Second, time.Second)
+		Eventually(events(crashingEvents)).ShouldNot(BeEmpty())
+		second, secondEvents, _ := start(graceful, time.Second, time.Second)
+		Eventually(second.IsLeader).Should(BeTrue())
+		Consistently(second.IsLeader, 300*time.Millisecond).Should(BeTrue())
+		Expect(events(secondEvents)()).To(Equal([]string{"start"}))
+	})
+
+	It("must wait for the restart delay before starting a crashing command again on the same node", func() {
+		_, crashingEvents, _ := start(crashing, time.Second, 200*time.Millisecond)
+		Eventually(events(crashingEvents)).ShouldNot(BeEmpty())
+		time.Sleep(time.Second)
+		// one start right away and then at most one every 200ms
+		Expect(len(events(crashingEvents)())).To(And(BeNumerically(">=", 3), BeNumerically("<=", 6)))
+	})
+})
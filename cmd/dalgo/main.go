@@ -0,0 +1,31 @@
+// Command dalgo runs the algorithms of this repository from the command line
+//
+//	dalgo leader-exec --zk 127.0.0.1:2181 --namespace /jobs/x -- ./my-cron --flag
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: dalgo <command> [flags]
+
+commands:
+  leader-exec  run a process only while this node is the leader of an election
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	switch os.Args[1] {
+	case "leader-exec":
+		os.Exit(leaderExecCommand(os.Args[2:]))
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
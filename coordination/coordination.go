@@ -0,0 +1,129 @@
+// Package coordination defines the small set of operations the election and registration algorithms need from a coordination store
+// The store is organized as a tree of nodes like zookeeper: nodes can be ephemeral, in which case they are removed when the session that created them ends,
+// and sequential, in which case the store appends a monotonically increasing counter to their name
+package coordination
+
+import (
+	"errors"
+)
+
+// CreateMode is the kind of node created by Session.Create
+type CreateMode int
+
+const (
+	// Persistent nodes stay until they are deleted
+	Persistent CreateMode = iota
+	// Ephemeral nodes are deleted when the session that created them ends
+	Ephemeral
+	// EphemeralSequential nodes are ephemeral nodes whose name is suffixed with a counter maintained by the parent node
+	EphemeralSequential
+	// Container nodes are persistent nodes that the store deletes once their last child is gone
+	Container
+)
+
+// SessionState is the state of a session, it is reported by the session events
+type SessionState int
+
+const (
+	// StateUnknown is the state of the events that are not about the session
+	StateUnknown SessionState = iota
+	// StateDisconnected means the connection is lost, the session may still be alive on the store
+	StateDisconnected
+	// StateConnecting means a connection is being established
+	StateConnecting
+	// StateConnected means a connection is established but the session is not confirmed yet
+	StateConnected
+	// StateHasSession means the session is established and usable
+	StateHasSession
+	// StateExpired means the session is gone, with all its ephemeral nodes and watches
+	StateExpired
+	// StateAuthFailed means the store refused the credentials of the session
+	StateAuthFailed
+)
+
+// EventType is the type of an event
+type EventType int
+
+const (
+	// EventSession is sent on the session events channel when the state of the session changes
+	EventSession EventType = iota
+	// EventNodeCreated is sent on a watch when the watched node is created
+	EventNodeCreated
+	// EventNodeDeleted is sent on a watch when the watched node is deleted
+	EventNodeDeleted
+	// EventNodeDataChanged is sent on a watch when the data of the watched node changes
+	EventNodeDataChanged
+	// EventNodeChildrenChanged is sent on a children watch when a child is created or deleted
+	EventNodeChildrenChanged
+	// EventNotWatching is sent on a watch when it will never fire because the session is gone, Err tells why
+	EventNotWatching
+)
+
+// Event is sent on the session events channel and on the watch channels
+// a watch channel receives a single event and is closed right after
+type Event struct {
+	// Type is the type of the event
+	Type EventType
+	// State is the state of the session for session events
+	State SessionState
+	// Path is the path of the node the event is about
+	Path string
+	// Err is set for EventNotWatching events
+	Err error
+}
+
+// Stat is the metadata of a node
+type Stat struct {
+	// CreateRevision is the revision of the store at which the node was created. Revisions are strictly increasing across the whole store
+	CreateRevision int64
+	// ModRevision is the revision of the store at which the node was last modified
+	ModRevision int64
+}
+
+var (
+	// ErrNoNode is returned when the node does not exist
+	ErrNoNode = errors.New("node does not exist")
+	// ErrNodeExists is returned when the node to create already exists
+	ErrNodeExists = errors.New("node already exists")
+	// ErrNotEmpty is returned when the node to delete has children
+	ErrNotEmpty = errors.New("node has children")
+	// ErrNoAuth is returned when the session is not allowed to perform the operation
+	ErrNoAuth = errors.New("not authorized")
+	// ErrSessionExpired is returned when the session expired
+	ErrSessionExpired = errors.New("session expired")
+	// ErrAuthFailed is returned when the store refused the credentials of the session
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrClosed is returned when the session has been closed
+	ErrClosed = errors.New("session closed")
+)
+
+// Session is a session with the coordination store, ephemeral nodes live as long as the session that created them
+// all the methods must be safe to call from multiple goroutines
+type Session interface {
+	// Create creates a node with the given data and returns its path, which is suffixed with a counter for sequential nodes
+	Create(path string, data []byte, mode CreateMode) (string, error)
+	// Delete deletes the node
+	Delete(path string) error
+	// Exists tells if the node exists
+	Exists(path string) (bool, Stat, error)
+	// ExistsW tells if the node exists and sets a watch that fires when it is created, deleted or its data changes
+	ExistsW(path string) (bool, Stat, <-chan Event, error)
+	// Get returns the data of the node
+	Get(path string) ([]byte, Stat, error)
+	// Set replaces the data of the node and returns its new metadata
+	Set(path string, data []byte) (Stat, error)
+	// Children returns the names of the children of the node, in no particular order
+	Children(path string) ([]string, error)
+	// ChildrenW returns the names of the children of the node and sets a watch that fires when a child is created or deleted
+	ChildrenW(path string) ([]string, <-chan Event, error)
+	// Events returns the channel on which the session events are sent. It is closed when the session is closed
+	Events() <-chan Event
+	// Close ends the session, its ephemeral nodes are deleted
+	Close()
+}
+
+// Backend opens sessions with a coordination store
+type Backend interface {
+	// Connect opens a new session. The session may not be established yet when it returns, Events reports when it is
+	Connect() (Session, error)
+}
@@ -0,0 +1,514 @@
+// Package etcd is a coordination backend on top of etcd
+// nodes are keys named after their path, ephemeral nodes are bound to the lease of the session and sequential nodes are numbered after the revision of the store when they are created
+package etcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Config is the configuration of the etcd backend
+type Config struct {
+	// Endpoints is a list of etcd servers
+	Endpoints []string
+	// DialTimeout is the timeout for the connection to etcd
+	DialTimeout time.Duration
+	// SessionTimeout is the time to live of the lease of the session, it is rounded up to the second
+	// the ephemeral nodes are deleted when the lease is not renewed for that long
+	// the lease is renewed every third of SessionTimeout and the session is reported as disconnected when two renewals in a row go unanswered,
+	// so StepDownOnDisconnect drops the leadership at least a third of SessionTimeout before the lease can expire
+	// and KeepLeadershipOnDisconnect keeps it until the client notices the expiry, which may be slightly after the server
+	// with FenceOnDisconnect the FenceTimeout of the election must stay below two thirds of SessionTimeout, since the last renewal may be a third of it older than the last answer
+	SessionTimeout time.Duration
+	// TLS is the configuration used to encrypt the connection. If it is not provided, the connection is plain TCP
+	TLS *utils.TLSConfig
+	// Username is the user used to authenticate the connection. If it is empty, the connection is not authenticated
+	Username string
+	// Password is the password of the user
+	Password string
+}
+
+// Backend opens etcd sessions
+type Backend struct {
+	config Config
+}
+
+// New returns an etcd backend with the given configuration
+func New(config Config) *Backend {
+	return &Backend{config: config}
+}
+
+// Connect connects to etcd and grants the lease that the ephemeral nodes of the session are bound to
+func (b *Backend) Connect() (coordination.Session, error) {
+	clientConfig := clientv3.Config{
+		Endpoints:   b.config.Endpoints,
+		DialTimeout: b.config.DialTimeout,
+		Username:    b.config.Username,
+		Password:    b.config.Password,
+	}
+	if b.config.TLS != nil {
+		tlsConfig, err := b.config.TLS.ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+		clientConfig.TLS = tlsConfig
+	}
+	client, err := clientv3.New(clientConfig)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ttl := int64((b.config.SessionTimeout + time.Second - 1) / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	grantCtx, grantCancel := context.WithTimeout(ctx, b.config.SessionTimeout+b.config.DialTimeout)
+	lease, err := client.Grant(grantCtx, ttl)
+	grantCancel()
+	if err != nil {
+		cancel()
+		client.Close()
+		return nil, err
+	}
+	keepAlive, err := client.KeepAlive(ctx, lease.ID)
+	if err != nil {
+		cancel()
+		client.Close()
+		return nil, err
+	}
+	s := &Session{
+		client:        client,
+		lease:         lease.ID,
+		ctx:           ctx,
+		cancel:        cancel,
+		events:        make(chan coordination.Event, 2),
+		closing:       make(chan struct{}),
+		keepAliveDone: make(chan struct{}),
+	}
+	s.events <- coordination.Event{Type: coordination.EventSession, State: coordination.StateConnected}
+	s.events <- coordination.Event{Type: coordination.EventSession, State: coordination.StateHasSession}
+	go s.keepAlive(keepAlive, time.Duration(ttl)*time.Second*2/3)
+	return s, nil
+}
+
+// Session is a coordination.Session bound to an etcd lease
+type Session struct {
+	client *clientv3.Client
+	// lease is the lease of the ephemeral nodes
+	lease clientv3.LeaseID
+	// ctx is cancelled when the session ends, it stops the keepalive and the watches
+	ctx    context.Context
+	cancel context.CancelFunc
+	// mu protects expired and closed
+	mu      sync.Mutex
+	expired bool
+	closed  bool
+	// closeOnce makes Close safe to call more than once
+	closeOnce sync.Once
+	// events is only written by keepAlive, it is closed by Close once keepAlive has returned
+	events chan coordination.Event
+	// closing is closed by Close to unblock keepAlive, keepAliveDone is closed when keepAlive returns
+	closing       chan struct{}
+	keepAliveDone chan struct{}
+}
+
+// keepAlive drains the keepalive responses and reports the state of the session
+// the client renews the lease every third of its time to live, the session is reported as disconnected when two renewals in a row go unanswered
+// and as connected again when the answers come back before the lease expires
+// the session is reported as expired when the lease cannot be renewed anymore, that event is always delivered unless the session is closed first
+func (s *Session) keepAlive(responses <-chan *clientv3.LeaseKeepAliveResponse, silence time.Duration) {
+	defer close(s.keepAliveDone)
+	timer := time.NewTimer(silence)
+	defer timer.Stop()
+	disconnected := false
+	for {
+		select {
+		case _, ok := <-responses:
+			if !ok {
+				s.expire()
+				return
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(silence)
+			if disconnected {
+				disconnected = false
+				if !s.send(coordination.StateConnected) || !s.send(coordination.StateHasSession) {
+					return
+				}
+			}
+		case <-timer.C:
+			disconnected = true
+			if !s.send(coordination.StateDisconnected) {
+				return
+			}
+		}
+	}
+}
+
+// send delivers a session event, it blocks until the event is read or the session is closed and returns false in the latter case
+func (s *Session) send(state coordination.SessionState) bool {
+	select {
+	case s.events <- coordination.Event{Type: coordination.EventSession, State: state}:
+		return true
+	case <-s.closing:
+		return false
+	}
+}
+
+// expire marks the session as expired and reports it
+func (s *Session) expire() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.expired = true
+	s.mu.Unlock()
+	// stop the watches, they are not worth anything without the lease
+	s.cancel()
+	s.send(coordination.StateExpired)
+}
+
+// err returns the error of the operations of the session once it has ended
+func (s *Session) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expired {
+		return coordination.ErrSessionExpired
+	}
+	if s.closed {
+		return coordination.ErrClosed
+	}
+	return nil
+}
+
+// convertError translates the etcd errors that the algorithms act upon
+func (s *Session) convertError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+		return coordination.ErrSessionExpired
+	}
+	if sessionErr := s.err(); sessionErr != nil {
+		return sessionErr
+	}
+	return err
+}
+
+// stat returns the metadata of a key
+func stat(createRevision, modRevision int64) coordination.Stat {
+	return coordination.Stat{CreateRevision: createRevision, ModRevision: modRevision}
+}
+
+// parent returns the path of the parent node, the root has no parent
+func parent(path string) string {
+	index := strings.LastIndex(path, "/")
+	if index <= 0 {
+		return "/"
+	}
+	return path[:index]
+}
+
+// parentExists is the condition of the transactions that need the parent node
+func parentExists(path string) []clientv3.Cmp {
+	parentPath := parent(path)
+	if parentPath == "/" {
+		return nil
+	}
+	return []clientv3.Cmp{clientv3.Compare(clientv3.CreateRevision(parentPath), ">", 0)}
+}
+
+// childrenPrefix returns the prefix of the keys of the children of the node
+func childrenPrefix(path string) string {
+	if path == "/" {
+		return path
+	}
+	return path + "/"
+}
+
+func (s *Session) Create(path string, data []byte, mode coordination.CreateMode) (string, error) {
+	err := s.err()
+	if err != nil {
+		return "", err
+	}
+	var opts []clientv3.OpOption
+	if mode == coordination.Ephemeral || mode == coordination.EphemeralSequential {
+		opts = append(opts, clientv3.WithLease(s.lease))
+	}
+	// etcd has no counter, so the sequential keys are named after the revision of the store when they are created and sort like their creation revision
+	// the name is taken before the key is created, the transaction only goes through if no sibling was created since that revision
+	// so a key is always named after all the keys that were created before it, and the joins that race retry with the revision they lost to
+	var revision int64
+	if mode == coordination.EphemeralSequential {
+		response, err := s.client.Get(s.ctx, parent(path), clientv3.WithKeysOnly())
+		if err != nil {
+			return "", s.convertError(err)
+		}
+		revision = response.Header.Revision
+	}
+	for {
+		created := path
+		conditions := parentExists(path)
+		if mode == coordination.EphemeralSequential {
+			created = fmt.Sprintf("%s%019d", path, revision+1)
+			conditions = append(conditions, clientv3.Compare(clientv3.CreateRevision(childrenPrefix(parent(path))), "<", revision+1).WithPrefix())
+		}
+		conditions = append(conditions, clientv3.Compare(clientv3.CreateRevision(created), "=", 0))
+		response, err := s.client.Txn(s.ctx).
+			If(conditions...).
+			Then(clientv3.OpPut(created, string(data), opts...)).
+			Else(clientv3.OpGet(parent(path)), clientv3.OpGet(created)).
+			Commit()
+		if err != nil {
+			return "", s.convertError(err)
+		}
+		if response.Succeeded {
+			return created, nil
+		}
+		if parent(path) != "/" && len(response.Responses[0].GetResponseRange().Kvs) == 0 {
+			return "", coordination.ErrNoNode
+		}
+		if mode != coordination.EphemeralSequential {
+			return "", coordination.ErrNodeExists
+		}
+		// a sibling was created in the meantime, try again after it
+		revision = response.Header.Revision
+	}
+}
+
+func (s *Session) Delete(path string) error {
+	err := s.err()
+	if err != nil {
+		return err
+	}
+	// the children are checked in the same transaction so that none can be created between the check and the delete
+	prefix := childrenPrefix(path)
+	response, err := s.client.Txn(s.ctx).
+		If(
+			clientv3.Compare(clientv3.CreateRevision(path), ">", 0),
+			clientv3.Compare(clientv3.CreateRevision(prefix), "=", 0).WithPrefix(),
+		).
+		Then(clientv3.OpDelete(path)).
+		Else(clientv3.OpGet(path, clientv3.WithKeysOnly())).
+		Commit()
+	if err != nil {
+		return s.convertError(err)
+	}
+	if response.Succeeded {
+		return nil
+	}
+	if len(response.Responses[0].GetResponseRange().Kvs) == 0 {
+		return coordination.ErrNoNode
+	}
+	return coordination.ErrNotEmpty
+}
+
+func (s *Session) Exists(path string) (bool, coordination.Stat, error) {
+	exists, stat, _, err := s.exists(path)
+	return exists, stat, err
+}
+
+// exists returns the metadata of the key and the revision of the store at which it was read
+func (s *Session) exists(path string) (bool, coordination.Stat, int64, error) {
+	err := s.err()
+	if err != nil {
+		return false, coordination.Stat{}, 0, err
+	}
+	response, err := s.client.Get(s.ctx, path, clientv3.WithKeysOnly())
+	if err != nil {
+		return false, coordination.Stat{}, 0, s.convertError(err)
+	}
+	if len(response.Kvs) == 0 {
+		return false, coordination.Stat{}, response.Header.Revision, nil
+	}
+	kv := response.Kvs[0]
+	return true, stat(kv.CreateRevision, kv.ModRevision), response.Header.Revision, nil
+}
+
+func (s *Session) ExistsW(path string) (bool, coordination.Stat, <-chan coordination.Event, error) {
+	exists, stat, revision, err := s.exists(path)
+	if err != nil {
+		return false, coordination.Stat{}, nil, err
+	}
+	// watching from the next revision guarantees that no change is missed between the read and the watch
+	return exists, stat, s.watch(path, revision+1, false), nil
+}
+
+func (s *Session) Get(path string) ([]byte, coordination.Stat, error) {
+	err := s.err()
+	if err != nil {
+		return nil, coordination.Stat{}, err
+	}
+	response, err := s.client.Get(s.ctx, path)
+	if err != nil {
+		return nil, coordination.Stat{}, s.convertError(err)
+	}
+	if len(response.Kvs) == 0 {
+		return nil, coordination.Stat{}, coordination.ErrNoNode
+	}
+	kv := response.Kvs[0]
+	return kv.Value, stat(kv.CreateRevision, kv.ModRevision), nil
+}
+
+func (s *Session) Set(path string, data []byte) (coordination.Stat, error) {
+	err := s.err()
+	if err != nil {
+		return coordination.Stat{}, err
+	}
+	response, err := s.client.Txn(s.ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(path), ">", 0)).
+		Then(clientv3.OpPut(path, string(data), clientv3.WithIgnoreLease()), clientv3.OpGet(path, clientv3.WithKeysOnly())).
+		Commit()
+	if err != nil {
+		return coordination.Stat{}, s.convertError(err)
+	}
+	if !response.Succeeded {
+		return coordination.Stat{}, coordination.ErrNoNode
+	}
+	kv := response.Responses[1].GetResponseRange().Kvs[0]
+	return stat(kv.CreateRevision, kv.ModRevision), nil
+}
+
+func (s *Session) Children(path string) ([]string, error) {
+	children, _, err := s.children(path)
+	return children, err
+}
+
+// children returns the names of the children of the node and the revision of the store at which they were read
+func (s *Session) children(path string) ([]string, int64, error) {
+	err := s.err()
+	if err != nil {
+		return nil, 0, err
+	}
+	var conditions []clientv3.Cmp
+	if path != "/" {
+		conditions = append(conditions, clientv3.Compare(clientv3.CreateRevision(path), ">", 0))
+	}
+	prefix := childrenPrefix(path)
+	response, err := s.client.Txn(s.ctx).
+		If(conditions...).
+		Then(clientv3.OpGet(prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())).
+		Commit()
+	if err != nil {
+		return nil, 0, s.convertError(err)
+	}
+	if !response.Succeeded {
+		return nil, 0, coordination.ErrNoNode
+	}
+	children := []string{}
+	for _, kv := range response.Responses[0].GetResponseRange().Kvs {
+		name := strings.TrimPrefix(string(kv.Key), prefix)
+		// only the direct children are listed
+		if !strings.Contains(name, "/") {
+			children = append(children, name)
+		}
+	}
+	return children, response.Header.Revision, nil
+}
+
+func (s *Session) ChildrenW(path string) ([]string, <-chan coordination.Event, error) {
+	children, revision, err := s.children(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return children, s.watch(path, revision+1, true), nil
+}
+
+// watch returns a one-shot watch on the key starting at the given revision
+// a children watch fires when a direct child of the key is created or deleted, or when the key itself is deleted
+func (s *Session) watch(path string, revision int64, children bool) <-chan coordination.Event {
+	events := make(chan coordination.Event, 1)
+	ctx, cancel := context.WithCancel(s.ctx)
+	opts := []clientv3.OpOption{clientv3.WithRev(revision)}
+	if children {
+		// the prefix also matches the siblings that share the name of the key as a prefix, they are filtered out below
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	watchResponses := s.client.Watch(ctx, path, opts...)
+	go func() {
+		defer close(events)
+		defer cancel()
+		for response := range watchResponses {
+			if response.Err() != nil {
+				break
+			}
+			for _, event := range response.Events {
+				converted, ok := convertEvent(path, event, children)
+				if ok {
+					events <- converted
+					return
+				}
+			}
+		}
+		err := s.err()
+		if err == nil {
+			err = coordination.ErrClosed
+		}
+		events <- coordination.Event{Type: coordination.EventNotWatching, Path: path, Err: err}
+	}()
+	return events
+}
+
+// convertEvent translates an etcd event on the watched key, ok is false if the event does not concern the watch
+func convertEvent(path string, event *clientv3.Event, children bool) (coordination.Event, bool) {
+	key := string(event.Kv.Key)
+	if key == path {
+		switch {
+		case event.Type == clientv3.EventTypeDelete:
+			return coordination.Event{Type: coordination.EventNodeDeleted, Path: path}, true
+		case children:
+			return coordination.Event{}, false
+		case event.IsCreate():
+			return coordination.Event{Type: coordination.EventNodeCreated, Path: path}, true
+		default:
+			return coordination.Event{Type: coordination.EventNodeDataChanged, Path: path}, true
+		}
+	}
+	name := strings.TrimPrefix(key, childrenPrefix(path))
+	if name == key || strings.Contains(name, "/") {
+		return coordination.Event{}, false
+	}
+	if event.Type == clientv3.EventTypeDelete || event.IsCreate() {
+		return coordination.Event{Type: coordination.EventNodeChildrenChanged, Path: path}, true
+	}
+	return coordination.Event{}, false
+}
+
+func (s *Session) Events() <-chan coordination.Event {
+	return s.events
+}
+
+// Close revokes the lease of the session, which deletes its ephemeral nodes, and closes the connection
+func (s *Session) Close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		expired := s.expired
+		s.mu.Unlock()
+		if !expired {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			s.client.Revoke(ctx, s.lease)
+			cancel()
+		}
+		close(s.closing)
+		s.cancel()
+		s.client.Close()
+		<-s.keepAliveDone
+		close(s.events)
+	})
+}
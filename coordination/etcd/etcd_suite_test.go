@@ -0,0 +1,120 @@
+package etcd_test
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+var (
+	Endpoints []string
+	Timeout   = time.Second * 2
+	server    *embed.Etcd
+)
+
+func TestEtcd(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Etcd Suite")
+}
+
+// freeURL returns a local url on a port that is free at the time of the call
+func freeURL() url.URL {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	defer listener.Close()
+	return url.URL{Scheme: "http", Host: listener.Addr().String()}
+}
+
+// Proxy forwards the connections of the clients to the server, Pause holds the traffic back without closing the connections
+type Proxy struct {
+	Endpoint string
+	listener net.Listener
+	// gate is write locked while the proxy is paused, the copies hold it for reading while they write
+	gate sync.RWMutex
+}
+
+// NewProxy starts a proxy to the server, it is closed at the end of the spec
+func NewProxy() *Proxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).To(BeNil())
+	DeferCleanup(listener.Close)
+	proxy := &Proxy{Endpoint: listener.Addr().String(), listener: listener}
+	go func() {
+		for {
+			client, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server, err := net.Dial("tcp", Endpoints[0])
+			if err != nil {
+				client.Close()
+				continue
+			}
+			go proxy.copy(client, server)
+			go proxy.copy(server, client)
+		}
+	}()
+	return proxy
+}
+
+// copy forwards the bytes read from src to dst until one of them is closed
+func (p *Proxy) copy(dst, src net.Conn) {
+	defer dst.Close()
+	defer src.Close()
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buffer)
+		if err != nil {
+			return
+		}
+		p.gate.RLock()
+		_, err = dst.Write(buffer[:n])
+		p.gate.RUnlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Pause holds the traffic back until Resume is called
+func (p *Proxy) Pause() {
+	p.gate.Lock()
+}
+
+// Resume forwards the traffic that was held back and the traffic to come
+func (p *Proxy) Resume() {
+	p.gate.Unlock()
+}
+
+var _ = BeforeSuite(func() {
+	dir, err := os.MkdirTemp("", "etcd")
+	Expect(err).To(BeNil())
+	DeferCleanup(os.RemoveAll, dir)
+	config := embed.NewConfig()
+	config.Dir = dir
+	config.LogLevel = "error"
+	clientURL, peerURL := freeURL(), freeURL()
+	config.ListenClientUrls = []url.URL{clientURL}
+	config.AdvertiseClientUrls = []url.URL{clientURL}
+	config.ListenPeerUrls = []url.URL{peerURL}
+	config.AdvertisePeerUrls = []url.URL{peerURL}
+	config.InitialCluster = fmt.Sprintf("%s=%s", config.Name, peerURL.String())
+	server, err = embed.StartEtcd(config)
+	Expect(err).To(BeNil())
+	Eventually(server.Server.ReadyNotify(), 10*time.Second).Should(BeClosed())
+	Endpoints = []string{clientURL.Host}
+})
+
+var _ = AfterSuite(func() {
+	server.Close()
+})
@@ -0,0 +1,295 @@
+package etcd_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/etcd"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var _ = Describe("Etcd backend", func() {
+	var (
+		backend   *etcd.Backend
+		client    *clientv3.Client
+		admin     coordination.Session
+		namespace string
+		err       error
+	)
+
+	// revokeOwner revokes the lease of the key, as etcd does when the owner stops renewing it
+	revokeOwner := func(key string) {
+		response, err := client.Get(context.Background(), key)
+		Expect(err).To(BeNil())
+		Expect(response.Kvs).To(HaveLen(1))
+		_, err = client.Revoke(context.Background(), clientv3.LeaseID(response.Kvs[0].Lease))
+		Expect(err).To(BeNil())
+	}
+
+	BeforeEach(func() {
+		backend = etcd.New(etcd.Config{Endpoints: Endpoints, DialTimeout: Timeout, SessionTimeout: Timeout})
+		client, err = clientv3.New(clientv3.Config{Endpoints: Endpoints, DialTimeout: Timeout})
+		Expect(err).To(BeNil())
+		admin, err = backend.Connect()
+		Expect(err).To(BeNil())
+		// every spec gets its own namespace so that the leftovers of the others do not matter
+		namespace = fmt.Sprintf("/election-%d", time.Now().UnixNano())
+		_, err = admin.Create(namespace, []byte{}, coordination.Persistent)
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		admin.Close()
+		client.Close()
+	})
+
+	Describe("Sessions", func() {
+		var session coordination.Session
+		BeforeEach(func() {
+			session, err = backend.Connect()
+			Expect(err).To(BeNil())
+			Eventually(session.Events()).Should(Receive(HaveField("State", coordination.StateConnected)))
+			Eventually(session.Events()).Should(Receive(HaveField("State", coordination.StateHasSession)))
+		})
+		AfterEach(func() {
+			session.Close()
+		})
+
+		It("must name the sequential keys after the revision of the store when they are created", func() {
+			first, err := session.Create(namespace+"/c_", []byte("a"), coordination.EphemeralSequential)
+			Expect(err).To(BeNil())
+			second, err := admin.Create(namespace+"/c_", []byte("b"), coordination.EphemeralSequential)
+			Expect(err).To(BeNil())
+			Expect(second > first).To(BeTrue())
+			_, firstStat, err := admin.Get(first)
+			Expect(err).To(BeNil())
+			data, secondStat, err := session.Get(second)
+			Expect(err).To(BeNil())
+			Expect(data).To(Equal([]byte("b")))
+			Expect(secondStat.CreateRevision).To(BeNumerically(">", firstStat.CreateRevision))
+			var sequence int64
+			_, err = fmt.Sscanf(strings.TrimPrefix(first, namespace+"/c_"), "%d", &sequence)
+			Expect(err).To(BeNil())
+			Expect(sequence).To(BeNumerically("<=", firstStat.CreateRevision))
+			children, err := admin.Children(namespace)
+			Expect(err).To(BeNil())
+			Expect(children).To(ConsistOf(strings.TrimPrefix(first, namespace+"/"), strings.TrimPrefix(second, namespace+"/")))
+			// nothing but the keys of the nodes is kept in etcd
+			response, err := client.Get(context.Background(), "\x00", clientv3.WithRange("/"), clientv3.WithKeysOnly())
+			Expect(err).To(BeNil())
+			Expect(response.Kvs).To(BeEmpty())
+		})
+
+		It("must order the sequential keys created concurrently by their creation revision", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer GinkgoRecover()
+					_, err := session.Create(namespace+"/c_", []byte{}, coordination.EphemeralSequential)
+					Expect(err).To(BeNil())
+				}()
+			}
+			wg.Wait()
+			children, err := admin.Children(namespace)
+			Expect(err).To(BeNil())
+			Expect(children).To(HaveLen(10))
+			sort.Strings(children)
+			previous := int64(0)
+			for _, child := range children {
+				_, stat, err := admin.Get(namespace + "/" + child)
+				Expect(err).To(BeNil())
+				Expect(stat.CreateRevision).To(BeNumerically(">", previous))
+				previous = stat.CreateRevision
+			}
+		})
+
+		It("must refuse keys without a parent and duplicated keys", func() {
+			_, err = session.Create(namespace+"/missing/c_", []byte{}, coordination.EphemeralSequential)
+			Expect(err).To(MatchError(coordination.ErrNoNode))
+			_, err = session.Create(namespace, []byte{}, coordination.Persistent)
+			Expect(err).To(MatchError(coordination.ErrNodeExists))
+			_, err = session.Set(namespace+"/missing", []byte{})
+			Expect(err).To(MatchError(coordination.ErrNoNode))
+			_, err = session.Children(namespace + "/missing")
+			Expect(err).To(MatchError(coordination.ErrNoNode))
+		})
+
+		It("must delete the ephemeral keys when the session closes", func() {
+			path, err := session.Create(namespace+"/c_", []byte{}, coordination.EphemeralSequential)
+			Expect(err).To(BeNil())
+			_, _, watch, err := admin.ExistsW(path)
+			Expect(err).To(BeNil())
+			session.Close()
+			Eventually(watch, Timeout).Should(Receive(Equal(coordination.Event{Type: coordination.EventNodeDeleted, Path: path})))
+			Expect(watch).To(BeClosed())
+			exists, _, err := admin.Exists(path)
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeFalse())
+		})
+
+		It("must only fire a children watch for the direct children of the key", func() {
+			_, watch, err := admin.ChildrenW(namespace)
+			Expect(err).To(BeNil())
+			_, err = session.Create(namespace+"-sibling", []byte{}, coordination.Persistent)
+			Expect(err).To(BeNil())
+			Consistently(watch, Timeout/4).ShouldNot(Receive())
+			_, err = session.Create(namespace+"/c_", []byte{}, coordination.EphemeralSequential)
+			Expect(err).To(BeNil())
+			Eventually(watch, Timeout).Should(Receive(Equal(coordination.Event{Type: coordination.EventNodeChildrenChanged, Path: namespace})))
+		})
+
+		It("must report the session as expired when its lease is lost", func() {
+			path, err := session.Create(namespace+"/c_", []byte{}, coordination.EphemeralSequential)
+			Expect(err).To(BeNil())
+			_, _, watch, err := session.ExistsW(namespace + "/other")
+			Expect(err).To(BeNil())
+			revokeOwner(path)
+			Eventually(session.Events(), Timeout*2).Should(Receive(HaveField("State", coordination.StateExpired)))
+			Eventually(watch, Timeout).Should(Receive(HaveField("Err", coordination.ErrSessionExpired)))
+			_, err = session.Children(namespace)
+			Expect(err).To(MatchError(coordination.ErrSessionExpired))
+		})
+
+		It("must refuse to delete a key that has children", func() {
+			_, err = session.Create(namespace+"/parent", []byte{}, coordination.Persistent)
+			Expect(err).To(BeNil())
+			child, err := session.Create(namespace+"/parent/c_", []byte{}, coordination.EphemeralSequential)
+			Expect(err).To(BeNil())
+			err = admin.Delete(namespace + "/parent")
+			Expect(err).To(MatchError(coordination.ErrNotEmpty))
+			err = admin.Delete(namespace + "/missing")
+			Expect(err).To(MatchError(coordination.ErrNoNode))
+			err = admin.Delete(child)
+			Expect(err).To(BeNil())
+			err = admin.Delete(namespace + "/parent")
+			Expect(err).To(BeNil())
+		})
+	})
+
+	Describe("Keepalives", func() {
+		var proxy *Proxy
+		// connect opens a session through the proxy
+		connect := func(sessionTimeout time.Duration) coordination.Session {
+			proxy = NewProxy()
+			session, err := etcd.New(etcd.Config{Endpoints: []string{proxy.Endpoint}, DialTimeout: Timeout, SessionTimeout: sessionTimeout}).Connect()
+			Expect(err).To(BeNil())
+			DeferCleanup(session.Close)
+			return session
+		}
+
+		It("must report the session as disconnected while the renewals go unanswered and as connected when they come back", func() {
+			session := connect(3 * Timeout)
+			Eventually(session.Events()).Should(Receive(HaveField("State", coordination.StateConnected)))
+			Eventually(session.Events()).Should(Receive(HaveField("State", coordination.StateHasSession)))
+			Consistently(session.Events(), Timeout).ShouldNot(Receive())
+			proxy.Pause()
+			// two renewals are sent every SessionTimeout/3
+			Eventually(session.Events(), 3*Timeout).Should(Receive(HaveField("State", coordination.StateDisconnected)))
+			proxy.Resume()
+			Eventually(session.Events(), Timeout).Should(Receive(HaveField("State", coordination.StateConnected)))
+			Eventually(session.Events()).Should(Receive(HaveField("State", coordination.StateHasSession)))
+			_, err = session.Children(namespace)
+			Expect(err).To(BeNil())
+		})
+
+		It("must deliver the expiry even if the earlier events have not been read", func() {
+			session := connect(Timeout)
+			proxy.Pause()
+			DeferCleanup(proxy.Resume)
+			// the client gives the lease up once it has not been renewed for its time to live
+			time.Sleep(2 * Timeout)
+			Expect(session.Events()).To(Receive(HaveField("State", coordination.StateConnected)))
+			Expect(session.Events()).To(Receive(HaveField("State", coordination.StateHasSession)))
+			Expect(session.Events()).To(Receive(HaveField("State", coordination.StateDisconnected)))
+			Eventually(session.Events(), Timeout).Should(Receive(HaveField("State", coordination.StateExpired)))
+		})
+	})
+
+	Describe("Leader election", func() {
+		var (
+			ctx        context.Context
+			cancel     context.CancelFunc
+			candidates []*election.LeaderElection
+		)
+		// start runs count candidates one after the other so that they queue in order
+		start := func(count int) {
+			for i := 0; i < count; i++ {
+				candidate, err := election.New(nil, namespace,
+					election.WithBackend(backend),
+					election.WithTimeout(Timeout),
+					election.WithBackoff(backoff.NewConstantBackOff(50*time.Millisecond)),
+					election.WithID(fmt.Sprintf("candidate-%d", i)),
+				)
+				Expect(err).To(BeNil())
+				candidates = append(candidates, candidate)
+				go candidate.Run(ctx)
+				Eventually(candidate.State, Timeout).Should(BeElementOf(election.Leader, election.Follower))
+			}
+		}
+		// leaderKey returns the key of the current leader
+		leaderKey := func() string {
+			leader, err := candidates[len(candidates)-1].GetLeader()
+			Expect(err).To(BeNil())
+			return namespace + "/" + leader.Znode
+		}
+		BeforeEach(func() {
+			candidates = nil
+			ctx, cancel = context.WithCancel(context.Background())
+		})
+		AfterEach(func() {
+			cancel()
+			for _, candidate := range candidates {
+				Eventually(candidate.State, Timeout).Should(Equal(election.Stopped))
+			}
+		})
+
+		It("must elect the first candidate and fail over when it leaves", func() {
+			start(3)
+			Expect(candidates[0].IsLeader()).To(BeTrue())
+			Expect(candidates[1].State()).To(Equal(election.Follower))
+			firstToken, _ := candidates[0].FencingToken()
+			Expect(candidates[0].Resign(ctx, election.Leave)).To(Succeed())
+			Eventually(candidates[1].IsLeader, Timeout).Should(BeTrue())
+			Expect(candidates[2].State()).To(Equal(election.Follower))
+			secondToken, _ := candidates[1].FencingToken()
+			Expect(secondToken).To(BeNumerically(">", firstToken))
+		})
+
+		It("must watch the predecessor and requeue a follower whose key was deleted", func() {
+			start(3)
+			children, err := admin.Children(namespace)
+			Expect(err).To(BeNil())
+			Expect(children).To(HaveLen(3))
+			candidatesInfo, err := candidates[0].Candidates()
+			Expect(err).To(BeNil())
+			Expect(admin.Delete(namespace + "/" + candidatesInfo[1].Znode)).To(Succeed())
+			Eventually(func() []string {
+				infos, err := candidates[0].Candidates()
+				Expect(err).To(BeNil())
+				ids := []string{}
+				for _, info := range infos {
+					ids = append(ids, info.ID)
+				}
+				return ids
+			}, Timeout).Should(Equal([]string{"candidate-0", "candidate-2", "candidate-1"}))
+			Expect(candidates[0].IsLeader()).To(BeTrue())
+		})
+
+		It("must hand over the leadership when the lease of the leader is lost", func() {
+			start(2)
+			revokeOwner(leaderKey())
+			Eventually(candidates[1].IsLeader, Timeout*2).Should(BeTrue())
+			Eventually(candidates[0].State, Timeout*2).Should(Equal(election.Follower))
+		})
+	})
+})
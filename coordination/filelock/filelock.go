@@ -0,0 +1,182 @@
+//go:build unix && !aix
+
+// Package filelock is a lease lock on top of flock for the processes of a single host
+// the operating system releases the lock as soon as the process that holds it dies, so the next process takes over without waiting for an expiry
+package filelock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+)
+
+// LeaseLock is an election.LeaseLock held with an exclusive flock on a shared file
+// the file holds the fencing token of the last acquisition and the name of its holder, the token is incremented on every acquisition
+// the durations are ignored: the lock never expires while its process lives, LeaseElection only uses them to pace its attempts
+type LeaseLock struct {
+	path string
+	// mu protects file, holder and token
+	mu sync.Mutex
+	// file is the open lock file while the lock is held
+	file *os.File
+	// holder is the holder of the lock
+	holder string
+	// token is the fencing token of the current term
+	token int64
+}
+
+// New returns a lock on the file at the given path, the file is created if it does not exist
+func New(path string) *LeaseLock {
+	return &LeaseLock{path: path}
+}
+
+// TryAcquire takes the lock if no other process or LeaseLock holds it
+func (l *LeaseLock) TryAcquire(ctx context.Context, holder string, duration time.Duration) (int64, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file != nil {
+		if l.holder != holder {
+			return 0, false, nil
+		}
+		same, err := l.sameFileLocked()
+		if err != nil {
+			return 0, false, err
+		}
+		if same {
+			// the holder starts a new term on the lock it already holds
+			return l.nextTermLocked(holder)
+		}
+		l.releaseLocked()
+	}
+	file, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, false, err
+	}
+	err = unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		file.Close()
+		return 0, false, nil
+	}
+	if err != nil {
+		file.Close()
+		return 0, false, err
+	}
+	l.file = file
+	// the file may have been removed or replaced between the open and the flock, in which case the lock is worth nothing
+	same, err := l.sameFileLocked()
+	if err != nil || !same {
+		l.releaseLocked()
+		return 0, false, err
+	}
+	token, ok, err := l.nextTermLocked(holder)
+	if err != nil {
+		l.releaseLocked()
+	}
+	return token, ok, err
+}
+
+// nextTermLocked increments the token stored in the file and records the holder. mu must be held and the lock taken
+func (l *LeaseLock) nextTermLocked(holder string) (int64, bool, error) {
+	_, err := l.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return 0, false, err
+	}
+	content, err := io.ReadAll(l.file)
+	if err != nil {
+		return 0, false, err
+	}
+	token := int64(0)
+	if len(strings.TrimSpace(string(content))) > 0 {
+		_, err = fmt.Sscanf(string(content), "%d", &token)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid lock file %s: %w", l.path, err)
+		}
+	}
+	token++
+	err = l.file.Truncate(0)
+	if err != nil {
+		return 0, false, err
+	}
+	_, err = l.file.WriteAt([]byte(fmt.Sprintf("%d %s\n", token, holder)), 0)
+	if err != nil {
+		return 0, false, err
+	}
+	// the token must survive a crash of the host, otherwise it could go backwards
+	err = l.file.Sync()
+	if err != nil {
+		return 0, false, err
+	}
+	l.holder, l.token = holder, token
+	return token, true, nil
+}
+
+// Renew checks that the lock is still held by the holder with the given token, there is nothing to extend
+// the lock is lost if the file was removed or replaced, since another process can then lock the new file at the same path
+func (l *LeaseLock) Renew(ctx context.Context, holder string, token int64, duration time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.heldLocked(holder, token) {
+		return election.ErrLeaseLost
+	}
+	same, err := l.sameFileLocked()
+	if err != nil {
+		return err
+	}
+	if !same {
+		l.releaseLocked()
+		return election.ErrLeaseLost
+	}
+	return nil
+}
+
+// Release unlocks and closes the file if the lock is still held by the holder with the given token
+func (l *LeaseLock) Release(ctx context.Context, holder string, token int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.heldLocked(holder, token) {
+		return election.ErrLeaseLost
+	}
+	return l.releaseLocked()
+}
+
+// heldLocked tells if the lock is held by the holder with the given token. mu must be held
+func (l *LeaseLock) heldLocked(holder string, token int64) bool {
+	return l.file != nil && l.holder == holder && l.token == token
+}
+
+// sameFileLocked tells if the path still leads to the locked file by comparing their device and inode. mu must be held and the file open
+func (l *LeaseLock) sameFileLocked() (bool, error) {
+	var held, current unix.Stat_t
+	err := unix.Fstat(int(l.file.Fd()), &held)
+	if err != nil {
+		return false, err
+	}
+	err = unix.Stat(l.path, &current)
+	if errors.Is(err, unix.ENOENT) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return held.Dev == current.Dev && held.Ino == current.Ino, nil
+}
+
+// releaseLocked unlocks and closes the file. mu must be held
+func (l *LeaseLock) releaseLocked() error {
+	err := unix.Flock(int(l.file.Fd()), unix.LOCK_UN)
+	closeErr := l.file.Close()
+	l.file = nil
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
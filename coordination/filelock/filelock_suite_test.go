@@ -0,0 +1,39 @@
+//go:build unix && !aix
+
+package filelock_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/filelock"
+)
+
+// holdEnv is the environment variable that turns the test binary into a process that holds the lock until it is killed
+const holdEnv = "FILELOCK_HOLD"
+
+func TestFilelock(t *testing.T) {
+	if path := os.Getenv(holdEnv); path != "" {
+		hold(path)
+		return
+	}
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Filelock Suite")
+}
+
+// hold takes the lock, tells the parent process and waits to be killed
+func hold(path string) {
+	_, ok, err := filelock.New(path).TryAcquire(context.Background(), "child", time.Second)
+	if err != nil || !ok {
+		fmt.Println("failed", err)
+		os.Exit(1)
+	}
+	fmt.Println("held")
+	time.Sleep(time.Hour)
+}
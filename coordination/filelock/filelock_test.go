@@ -0,0 +1,120 @@
+//go:build unix && !aix
+
+package filelock_test
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/filelock"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+)
+
+var _ = Describe("File lock election", func() {
+	var (
+		path       string
+		ctx        context.Context
+		cancel     context.CancelFunc
+		candidates []*election.LeaseElection
+		cancels    []context.CancelFunc
+	)
+
+	// start runs a candidate with its own lock, which behaves like another process on the same file
+	start := func(id string) *election.LeaseElection {
+		candidate := &election.LeaseElection{
+			Lock:          filelock.New(path),
+			ID:            id,
+			LeaseDuration: time.Second,
+			RenewDeadline: 600 * time.Millisecond,
+			RetryPeriod:   50 * time.Millisecond,
+		}
+		candidateCtx, candidateCancel := context.WithCancel(ctx)
+		candidates = append(candidates, candidate)
+		cancels = append(cancels, candidateCancel)
+		go candidate.Run(candidateCtx)
+		Eventually(candidate.State).Should(BeElementOf(election.Leader, election.Follower))
+		return candidate
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "election.lock")
+		candidates, cancels = nil, nil
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+	AfterEach(func() {
+		cancel()
+		for _, candidate := range candidates {
+			Eventually(candidate.State).Should(Equal(election.Stopped))
+		}
+	})
+
+	It("must elect a single leader and hand over with a bigger token when it stops", func() {
+		first := start("first")
+		second := start("second")
+		Expect(first.IsLeader()).To(BeTrue())
+		Consistently(second.IsLeader, 300*time.Millisecond).Should(BeFalse())
+		firstToken, _ := first.FencingToken()
+		cancels[0]()
+		Eventually(second.IsLeader).Should(BeTrue())
+		secondToken, _ := second.FencingToken()
+		Expect(secondToken).To(Equal(firstToken + 1))
+		content, err := os.ReadFile(path)
+		Expect(err).To(BeNil())
+		Expect(string(content)).To(Equal("2 second\n"))
+	})
+
+	It("must take over as soon as the process holding the lock dies", func() {
+		holder := exec.Command(os.Args[0], "-test.run=^TestFilelock$")
+		holder.Env = append(os.Environ(), "FILELOCK_HOLD="+path)
+		stdout, err := holder.StdoutPipe()
+		Expect(err).To(BeNil())
+		Expect(holder.Start()).To(Succeed())
+		line, err := bufio.NewReader(stdout).ReadString('\n')
+		Expect(err).To(BeNil())
+		Expect(line).To(Equal("held\n"))
+
+		candidate := start("candidate")
+		Expect(candidate.State()).To(Equal(election.Follower))
+		Consistently(candidate.IsLeader, 300*time.Millisecond).Should(BeFalse())
+		Expect(holder.Process.Kill()).To(Succeed())
+		holder.Wait()
+		Eventually(candidate.IsLeader).Should(BeTrue())
+		token, _ := candidate.FencingToken()
+		Expect(token).To(Equal(int64(2)))
+	})
+
+	It("must step down when the file is removed while the lock is held", func() {
+		first := start("first")
+		Expect(first.IsLeader()).To(BeTrue())
+		Expect(os.Remove(path)).To(Succeed())
+		// the next process creates and locks a new file at the same path
+		second := start("second")
+		Expect(second.IsLeader()).To(BeTrue())
+		Eventually(first.IsLeader).Should(BeFalse())
+		Consistently(first.IsLeader, 300*time.Millisecond).Should(BeFalse())
+	})
+
+	It("must refuse to renew or release the lock under another token", func() {
+		lock := filelock.New(path)
+		token, ok, err := lock.TryAcquire(context.Background(), "candidate", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+		_, ok, err = filelock.New(path).TryAcquire(context.Background(), "other", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeFalse())
+		Expect(lock.Renew(context.Background(), "candidate", token+1, time.Second)).To(MatchError(election.ErrLeaseLost))
+		Expect(lock.Release(context.Background(), "other", token)).To(MatchError(election.ErrLeaseLost))
+		Expect(lock.Renew(context.Background(), "candidate", token, time.Second)).To(Succeed())
+		Expect(lock.Release(context.Background(), "candidate", token)).To(Succeed())
+		_, ok, err = filelock.New(path).TryAcquire(context.Background(), "other", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+	})
+})
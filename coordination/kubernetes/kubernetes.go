@@ -0,0 +1,183 @@
+// Package kubernetes is a lease lock on top of the coordination.k8s.io/v1 Lease objects
+// it lets election.LeaseElection run on a kubernetes cluster without any other coordination store
+package kubernetes
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+)
+
+// LeaseLock is an election.LeaseLock stored in a Lease object
+// the fencing token is the number of transitions of the lease, which is incremented on every acquisition
+type LeaseLock struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+	// mu protects observed and observedTime
+	mu sync.Mutex
+	// observed is the last record read from the lease
+	observed coordinationv1.LeaseSpec
+	// observedTime is the local time at which the record was first seen
+	// expiries are computed from it rather than from the renew time written by the holder, so that the clocks of the nodes do not have to agree
+	observedTime time.Time
+}
+
+// New returns a lock stored in the Lease object with the given namespace and name, the object is created on the first acquisition
+func New(client kubernetes.Interface, namespace, name string) *LeaseLock {
+	return &LeaseLock{client: client, namespace: namespace, name: name}
+}
+
+// TryAcquire takes the lease if it does not exist, has no holder, is held by the holder or has not been renewed for its duration
+func (l *LeaseLock) TryAcquire(ctx context.Context, holder string, duration time.Duration) (int64, bool, error) {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(time.Now())
+	lease, err := leases.Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: l.name, Namespace: l.namespace},
+			Spec:       record(holder, duration, now, 1),
+		}
+		lease.Spec.AcquireTime = &now
+		_, err = leases.Create(ctx, lease, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return 0, false, nil
+		}
+		if err != nil {
+			return 0, false, err
+		}
+		l.observe(lease.Spec)
+		return 1, true, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	current := lease.Spec
+	l.observe(current)
+	if holderOf(current) != "" && holderOf(current) != holder && !l.expired(current) {
+		return 0, false, nil
+	}
+	transitions := int32(1)
+	if current.LeaseTransitions != nil {
+		transitions = *current.LeaseTransitions + 1
+	}
+	lease.Spec = record(holder, duration, now, transitions)
+	lease.Spec.AcquireTime = &now
+	// the update carries the resource version that was read, so only one of the nodes racing for an expired lease wins
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	l.observe(lease.Spec)
+	return int64(transitions), true, nil
+}
+
+// Renew updates the renew time of the lease if it is still held by the holder with the given token
+func (l *LeaseLock) Renew(ctx context.Context, holder string, token int64, duration time.Duration) error {
+	lease, err := l.held(ctx, holder, token)
+	if err != nil {
+		return err
+	}
+	now := metav1.NewMicroTime(time.Now())
+	acquireTime := lease.Spec.AcquireTime
+	lease.Spec = record(holder, duration, now, int32(token))
+	lease.Spec.AcquireTime = acquireTime
+	_, err = l.client.CoordinationV1().Leases(l.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	l.observe(lease.Spec)
+	return nil
+}
+
+// Release clears the holder of the lease if it is still held by the holder with the given token
+// the transitions are kept so that the next holder gets a bigger token
+func (l *LeaseLock) Release(ctx context.Context, holder string, token int64) error {
+	lease, err := l.held(ctx, holder, token)
+	if err != nil {
+		return err
+	}
+	lease.Spec.HolderIdentity = nil
+	_, err = l.client.CoordinationV1().Leases(l.namespace).Update(ctx, lease, metav1.UpdateOptions{})
+	return err
+}
+
+// held reads the lease and returns election.ErrLeaseLost if it is not held by the holder with the given token
+func (l *LeaseLock) held(ctx context.Context, holder string, token int64) (*coordinationv1.Lease, error) {
+	lease, err := l.client.CoordinationV1().Leases(l.namespace).Get(ctx, l.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, election.ErrLeaseLost
+	}
+	if err != nil {
+		return nil, err
+	}
+	if holderOf(lease.Spec) != holder || lease.Spec.LeaseTransitions == nil || int64(*lease.Spec.LeaseTransitions) != token {
+		return nil, election.ErrLeaseLost
+	}
+	return lease, nil
+}
+
+// observe records the time at which the record changed for the first time
+func (l *LeaseLock) observe(spec coordinationv1.LeaseSpec) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !sameRecord(spec, l.observed) {
+		l.observed = spec
+		l.observedTime = time.Now()
+	}
+}
+
+// expired tells if the record has not changed for longer than its duration
+func (l *LeaseLock) expired(spec coordinationv1.LeaseSpec) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	duration := time.Duration(0)
+	if spec.LeaseDurationSeconds != nil {
+		duration = time.Duration(*spec.LeaseDurationSeconds) * time.Second
+	}
+	return time.Since(l.observedTime) > duration
+}
+
+// record returns the spec of a lease held by the holder
+// lease durations are stored in seconds, they are rounded up
+func record(holder string, duration time.Duration, renewTime metav1.MicroTime, transitions int32) coordinationv1.LeaseSpec {
+	seconds := int32((duration + time.Second - 1) / time.Second)
+	return coordinationv1.LeaseSpec{
+		HolderIdentity:       &holder,
+		LeaseDurationSeconds: &seconds,
+		RenewTime:            &renewTime,
+		LeaseTransitions:     &transitions,
+	}
+}
+
+// holderOf returns the holder of the lease, empty if it is free
+func holderOf(spec coordinationv1.LeaseSpec) string {
+	if spec.HolderIdentity == nil {
+		return ""
+	}
+	return *spec.HolderIdentity
+}
+
+// sameRecord tells if two records have the same holder, renew time and transitions
+func sameRecord(a, b coordinationv1.LeaseSpec) bool {
+	if holderOf(a) != holderOf(b) {
+		return false
+	}
+	if (a.LeaseTransitions == nil) != (b.LeaseTransitions == nil) || (a.LeaseTransitions != nil && *a.LeaseTransitions != *b.LeaseTransitions) {
+		return false
+	}
+	if (a.RenewTime == nil) != (b.RenewTime == nil) {
+		return false
+	}
+	return a.RenewTime == nil || a.RenewTime.Equal(b.RenewTime)
+}
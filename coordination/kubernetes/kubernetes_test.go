@@ -0,0 +1,192 @@
+package kubernetes_test
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/kubernetes"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+)
+
+const (
+	namespace = "default"
+	leaseName = "election"
+)
+
+var _ = Describe("Kubernetes lease election", func() {
+	var (
+		client     *fake.Clientset
+		ctx        context.Context
+		cancel     context.CancelFunc
+		candidates []*election.LeaseElection
+		cancels    []context.CancelFunc
+	)
+
+	// start runs a candidate with its own lock instance, like a node of its own would
+	start := func(id string) *election.LeaseElection {
+		candidate := &election.LeaseElection{
+			Lock:          kubernetes.New(client, namespace, leaseName),
+			ID:            id,
+			LeaseDuration: time.Second,
+			RenewDeadline: 600 * time.Millisecond,
+			RetryPeriod:   100 * time.Millisecond,
+		}
+		candidateCtx, candidateCancel := context.WithCancel(ctx)
+		candidates = append(candidates, candidate)
+		cancels = append(cancels, candidateCancel)
+		go candidate.Run(candidateCtx)
+		Eventually(candidate.State).Should(BeElementOf(election.Leader, election.Follower))
+		return candidate
+	}
+	// lease returns the lease object
+	lease := func() *coordinationv1.Lease {
+		lease, err := client.CoordinationV1().Leases(namespace).Get(context.Background(), leaseName, metav1.GetOptions{})
+		Expect(err).To(BeNil())
+		return lease
+	}
+
+	BeforeEach(func() {
+		client = fake.NewSimpleClientset()
+		candidates, cancels = nil, nil
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+	AfterEach(func() {
+		cancel()
+		for _, candidate := range candidates {
+			Eventually(candidate.State).Should(Equal(election.Stopped))
+		}
+	})
+
+	It("must elect the first candidate and record it as the holder of the lease", func() {
+		elected := make(chan int64, 1)
+		first := &election.LeaseElection{
+			Lock:          kubernetes.New(client, namespace, leaseName),
+			ID:            "first",
+			LeaseDuration: time.Second,
+			RenewDeadline: 600 * time.Millisecond,
+			RetryPeriod:   100 * time.Millisecond,
+		}
+		first.OnElected = func(ctx context.Context) {
+			token, _ := election.FencingTokenFromContext(ctx)
+			elected <- token
+		}
+		candidates = append(candidates, first)
+		go first.Run(ctx)
+		Eventually(elected).Should(Receive(Equal(int64(1))))
+		second := start("second")
+		Expect(second.State()).To(Equal(election.Follower))
+		Consistently(second.IsLeader, 1500*time.Millisecond).Should(BeFalse())
+		Expect(*lease().Spec.HolderIdentity).To(Equal("first"))
+		Expect(*lease().Spec.LeaseDurationSeconds).To(Equal(int32(1)))
+	})
+
+	It("must release the lease on cancel so that the next candidate takes over with a bigger token", func() {
+		first := start("first")
+		second := start("second")
+		Expect(first.IsLeader()).To(BeTrue())
+		firstToken, _ := first.FencingToken()
+		cancels[0]()
+		Eventually(first.State).Should(Equal(election.Stopped))
+		// the lease is released so the takeover does not wait for the lease duration
+		Eventually(second.IsLeader, 500*time.Millisecond).Should(BeTrue())
+		secondToken, _ := second.FencingToken()
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+		Expect(*lease().Spec.HolderIdentity).To(Equal("second"))
+	})
+
+	It("must take over a lease that is not renewed only after its duration", func() {
+		now := metav1.NewMicroTime(time.Now())
+		holder, seconds, transitions := "ghost", int32(1), int32(7)
+		_, err := client.CoordinationV1().Leases(namespace).Create(context.Background(), &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{Name: leaseName, Namespace: namespace},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &holder,
+				LeaseDurationSeconds: &seconds,
+				RenewTime:            &now,
+				LeaseTransitions:     &transitions,
+			},
+		}, metav1.CreateOptions{})
+		Expect(err).To(BeNil())
+		candidate := start("candidate")
+		Expect(candidate.State()).To(Equal(election.Follower))
+		Consistently(candidate.IsLeader, 800*time.Millisecond).Should(BeFalse())
+		Eventually(candidate.IsLeader, time.Second).Should(BeTrue())
+		token, _ := candidate.FencingToken()
+		Expect(token).To(Equal(int64(8)))
+	})
+
+	It("must step down when the lease is taken by someone else", func() {
+		revoked := make(chan struct{}, 1)
+		candidate := &election.LeaseElection{
+			Lock:          kubernetes.New(client, namespace, leaseName),
+			ID:            "candidate",
+			LeaseDuration: time.Second,
+			RenewDeadline: 600 * time.Millisecond,
+			RetryPeriod:   100 * time.Millisecond,
+		}
+		candidate.OnRevoked = func() {
+			revoked <- struct{}{}
+		}
+		candidates = append(candidates, candidate)
+		go candidate.Run(ctx)
+		Eventually(candidate.IsLeader).Should(BeTrue())
+		stolen := lease()
+		thief := "thief"
+		stolen.Spec.HolderIdentity = &thief
+		_, err := client.CoordinationV1().Leases(namespace).Update(context.Background(), stolen, metav1.UpdateOptions{})
+		Expect(err).To(BeNil())
+		Eventually(revoked).Should(Receive())
+		Expect(candidate.State()).To(Equal(election.Follower))
+	})
+
+	It("must step down when the lease cannot be renewed before the renew deadline", func() {
+		candidate := start("candidate")
+		Expect(candidate.IsLeader()).To(BeTrue())
+		var failing atomic.Bool
+		failing.Store(true)
+		client.PrependReactor("update", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if failing.Load() {
+				return true, nil, apierrors.NewServiceUnavailable("apiserver is down")
+			}
+			return false, nil, nil
+		})
+		Eventually(candidate.State).Should(Equal(election.Disconnected))
+		failing.Store(false)
+		// the node still holds the lease so it takes it back with a new term
+		Eventually(candidate.IsLeader).Should(BeTrue())
+		token, _ := candidate.FencingToken()
+		Expect(token).To(Equal(int64(2)))
+	})
+
+	It("must not acquire the lease when another node wins the race for it", func() {
+		client.PrependReactor("create", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewAlreadyExists(schema.GroupResource{Group: "coordination.k8s.io", Resource: "leases"}, leaseName)
+		})
+		lock := kubernetes.New(client, namespace, leaseName)
+		_, ok, err := lock.TryAcquire(context.Background(), "candidate", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("must refuse to renew or release a lease held under another token", func() {
+		lock := kubernetes.New(client, namespace, leaseName)
+		token, ok, err := lock.TryAcquire(context.Background(), "candidate", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+		Expect(lock.Renew(context.Background(), "candidate", token+1, time.Second)).To(MatchError(election.ErrLeaseLost))
+		Expect(lock.Release(context.Background(), "other", token)).To(MatchError(election.ErrLeaseLost))
+		Expect(lock.Release(context.Background(), "candidate", token)).To(Succeed())
+		Expect(lease().Spec.HolderIdentity).To(BeNil())
+	})
+})
@@ -0,0 +1,478 @@
+// Package memory is an in-process coordination store for tests
+// it models sessions, ephemeral, sequential and container nodes, one-shot watches, and lets the tests disconnect and expire sessions on demand
+package memory
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+)
+
+// Store is an in-memory coordination store. It is a coordination.Backend, every Connect opens a new session on the same tree
+type Store struct {
+	// mu protects every field of the store and of its sessions
+	mu sync.Mutex
+	// nodes are the nodes of the tree indexed by path, the root always exists
+	nodes map[string]*node
+	// revision is incremented on every change of the tree
+	revision int64
+	// existsWatches are the watches set by ExistsW, indexed by path
+	existsWatches map[string][]watch
+	// childrenWatches are the watches set by ChildrenW, indexed by path
+	childrenWatches map[string][]watch
+	// sessions are the sessions that have not been closed
+	sessions []*Session
+}
+
+// node is a node of the tree
+type node struct {
+	data []byte
+	// owner is the session that created an ephemeral node, nil for the other nodes
+	owner *Session
+	// container nodes are deleted with their last child
+	container bool
+	// children are the names of the children of the node
+	children map[string]struct{}
+	// sequence is the counter appended to the name of the sequential children
+	sequence int64
+	stat     coordination.Stat
+}
+
+// watch is a one-shot watch set by a session
+type watch struct {
+	session *Session
+	events  chan coordination.Event
+}
+
+// New returns an empty store
+func New() *Store {
+	return &Store{
+		nodes:           map[string]*node{"/": {children: map[string]struct{}{}}},
+		existsWatches:   map[string][]watch{},
+		childrenWatches: map[string][]watch{},
+	}
+}
+
+// Connect opens a new session, it is established right away
+func (s *Store) Connect() (coordination.Session, error) {
+	session := &Session{
+		store:   s,
+		state:   coordination.StateHasSession,
+		events:  make(chan coordination.Event),
+		pending: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go session.forwardEvents()
+	s.mu.Lock()
+	s.sessions = append(s.sessions, session)
+	session.publishLocked(coordination.Event{Type: coordination.EventSession, State: coordination.StateConnected})
+	session.publishLocked(coordination.Event{Type: coordination.EventSession, State: coordination.StateHasSession})
+	s.mu.Unlock()
+	return session, nil
+}
+
+// Sessions returns the sessions that have not been closed, in the order in which they were opened
+func (s *Store) Sessions() []*Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Session{}, s.sessions...)
+}
+
+// Watches returns the number of watches that are set and have not fired yet
+func (s *Store) Watches() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for _, watches := range []map[string][]watch{s.existsWatches, s.childrenWatches} {
+		for _, pathWatches := range watches {
+			count += len(pathWatches)
+		}
+	}
+	return count
+}
+
+// Session is a session with the in-memory store
+type Session struct {
+	store *Store
+	// state is the state of the session, operations only succeed with StateHasSession
+	state coordination.SessionState
+	// closed is true once Close has been called
+	closed bool
+	// stalled is true between Stall and Disconnect, the operations fail but the disconnect has not been reported yet
+	stalled bool
+	// queue holds the session events that have not been forwarded yet
+	queue []coordination.Event
+	// events is the channel returned by Events
+	events chan coordination.Event
+	// pending is signalled when events are added to the queue
+	pending chan struct{}
+	// done is closed by Close
+	done chan struct{}
+}
+
+// Disconnect simulates the loss of the connection: the session stays alive on the store but its operations fail with coordination.ErrClosed
+// the watches stay set, like zookeeper does when the client reconnects in time
+func (s *Session) Disconnect() {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	if s.state != coordination.StateHasSession && !s.stalled {
+		return
+	}
+	s.state = coordination.StateDisconnected
+	s.stalled = false
+	s.publishLocked(coordination.Event{Type: coordination.EventSession, State: coordination.StateDisconnected})
+}
+
+// FailAuth simulates the store refusing the credentials of the session: its operations fail with coordination.ErrAuthFailed
+func (s *Session) FailAuth() {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	if s.closed || s.state == coordination.StateExpired {
+		return
+	}
+	s.state = coordination.StateAuthFailed
+	s.stalled = false
+	s.publishLocked(coordination.Event{Type: coordination.EventSession, State: coordination.StateAuthFailed})
+}
+
+// Stall simulates a connection that stopped answering before the client noticed: the operations fail with coordination.ErrClosed but no event is sent
+// a real client only reports the disconnect after a while without answers, Disconnect reports it
+func (s *Session) Stall() {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	if s.state != coordination.StateHasSession {
+		return
+	}
+	s.state = coordination.StateDisconnected
+	s.stalled = true
+}
+
+// Reconnect simulates a reconnection within the session timeout after Disconnect
+func (s *Session) Reconnect() {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	if s.state != coordination.StateDisconnected {
+		return
+	}
+	s.state = coordination.StateHasSession
+	s.stalled = false
+	s.publishLocked(coordination.Event{Type: coordination.EventSession, State: coordination.StateConnected})
+	s.publishLocked(coordination.Event{Type: coordination.EventSession, State: coordination.StateHasSession})
+}
+
+// Expire simulates the expiry of the session: its ephemeral nodes are deleted, its watches stop and its operations fail with coordination.ErrSessionExpired
+func (s *Session) Expire() {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	if s.closed || s.state == coordination.StateExpired {
+		return
+	}
+	s.state = coordination.StateExpired
+	s.store.endSessionLocked(s, coordination.ErrSessionExpired)
+	s.publishLocked(coordination.Event{Type: coordination.EventSession, State: coordination.StateExpired})
+}
+
+// Close ends the session, its ephemeral nodes are deleted and its events channel is closed
+func (s *Session) Close() {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	if s.state != coordination.StateExpired {
+		s.store.endSessionLocked(s, coordination.ErrClosed)
+	}
+	for i, session := range s.store.sessions {
+		if session == s {
+			s.store.sessions = append(s.store.sessions[:i], s.store.sessions[i+1:]...)
+			break
+		}
+	}
+	close(s.done)
+}
+
+// Events returns the channel on which the session events are sent. It is closed when the session is closed
+func (s *Session) Events() <-chan coordination.Event {
+	return s.events
+}
+
+// publishLocked queues a session event. The store lock must be held
+func (s *Session) publishLocked(event coordination.Event) {
+	s.queue = append(s.queue, event)
+	select {
+	case s.pending <- struct{}{}:
+	default:
+	}
+}
+
+// forwardEvents sends the queued session events in order until the session is closed
+// the queue is unbounded so that the store never blocks on a slow reader
+func (s *Session) forwardEvents() {
+	defer close(s.events)
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.pending:
+		}
+		for {
+			s.store.mu.Lock()
+			if len(s.queue) == 0 {
+				s.store.mu.Unlock()
+				break
+			}
+			event := s.queue[0]
+			s.queue = s.queue[1:]
+			s.store.mu.Unlock()
+			select {
+			case <-s.done:
+				return
+			case s.events <- event:
+			}
+		}
+	}
+}
+
+// checkLocked returns the error of the operations of the session in its current state. The store lock must be held
+func (s *Session) checkLocked() error {
+	switch {
+	case s.closed:
+		return coordination.ErrClosed
+	case s.state == coordination.StateExpired:
+		return coordination.ErrSessionExpired
+	case s.state == coordination.StateAuthFailed:
+		return coordination.ErrAuthFailed
+	case s.state != coordination.StateHasSession:
+		return coordination.ErrClosed
+	}
+	return nil
+}
+
+func (s *Session) Create(nodePath string, data []byte, mode coordination.CreateMode) (string, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	err := s.checkLocked()
+	if err != nil {
+		return "", err
+	}
+	parentPath, name := path.Split(nodePath)
+	parentPath = parentDir(parentPath)
+	parent, ok := s.store.nodes[parentPath]
+	if !ok {
+		return "", coordination.ErrNoNode
+	}
+	if mode == coordination.EphemeralSequential {
+		name += fmt.Sprintf("%010d", parent.sequence)
+		nodePath += fmt.Sprintf("%010d", parent.sequence)
+	}
+	if _, ok := s.store.nodes[nodePath]; ok {
+		return "", coordination.ErrNodeExists
+	}
+	parent.sequence++
+	s.store.revision++
+	created := &node{
+		data:      append([]byte{}, data...),
+		container: mode == coordination.Container,
+		children:  map[string]struct{}{},
+		stat:      coordination.Stat{CreateRevision: s.store.revision, ModRevision: s.store.revision},
+	}
+	if mode == coordination.Ephemeral || mode == coordination.EphemeralSequential {
+		created.owner = s
+	}
+	s.store.nodes[nodePath] = created
+	parent.children[name] = struct{}{}
+	s.store.fireLocked(s.store.existsWatches, nodePath, coordination.EventNodeCreated)
+	s.store.fireLocked(s.store.childrenWatches, parentPath, coordination.EventNodeChildrenChanged)
+	return nodePath, nil
+}
+
+func (s *Session) Delete(nodePath string) error {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	err := s.checkLocked()
+	if err != nil {
+		return err
+	}
+	return s.store.deleteLocked(nodePath)
+}
+
+func (s *Session) Exists(nodePath string) (bool, coordination.Stat, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	err := s.checkLocked()
+	if err != nil {
+		return false, coordination.Stat{}, err
+	}
+	n, ok := s.store.nodes[nodePath]
+	if !ok {
+		return false, coordination.Stat{}, nil
+	}
+	return true, n.stat, nil
+}
+
+func (s *Session) ExistsW(nodePath string) (bool, coordination.Stat, <-chan coordination.Event, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	err := s.checkLocked()
+	if err != nil {
+		return false, coordination.Stat{}, nil, err
+	}
+	events := s.store.watchLocked(s.store.existsWatches, nodePath, s)
+	n, ok := s.store.nodes[nodePath]
+	if !ok {
+		return false, coordination.Stat{}, events, nil
+	}
+	return true, n.stat, events, nil
+}
+
+func (s *Session) Get(nodePath string) ([]byte, coordination.Stat, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	err := s.checkLocked()
+	if err != nil {
+		return nil, coordination.Stat{}, err
+	}
+	n, ok := s.store.nodes[nodePath]
+	if !ok {
+		return nil, coordination.Stat{}, coordination.ErrNoNode
+	}
+	return append([]byte{}, n.data...), n.stat, nil
+}
+
+func (s *Session) Set(nodePath string, data []byte) (coordination.Stat, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	err := s.checkLocked()
+	if err != nil {
+		return coordination.Stat{}, err
+	}
+	n, ok := s.store.nodes[nodePath]
+	if !ok {
+		return coordination.Stat{}, coordination.ErrNoNode
+	}
+	s.store.revision++
+	n.data = append([]byte{}, data...)
+	n.stat.ModRevision = s.store.revision
+	s.store.fireLocked(s.store.existsWatches, nodePath, coordination.EventNodeDataChanged)
+	return n.stat, nil
+}
+
+func (s *Session) Children(nodePath string) ([]string, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	err := s.checkLocked()
+	if err != nil {
+		return nil, err
+	}
+	return s.store.childrenLocked(nodePath)
+}
+
+func (s *Session) ChildrenW(nodePath string) ([]string, <-chan coordination.Event, error) {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+	err := s.checkLocked()
+	if err != nil {
+		return nil, nil, err
+	}
+	children, err := s.store.childrenLocked(nodePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return children, s.store.watchLocked(s.store.childrenWatches, nodePath, s), nil
+}
+
+// childrenLocked returns the sorted names of the children of the node. The store lock must be held
+func (s *Store) childrenLocked(nodePath string) ([]string, error) {
+	n, ok := s.nodes[nodePath]
+	if !ok {
+		return nil, coordination.ErrNoNode
+	}
+	children := make([]string, 0, len(n.children))
+	for child := range n.children {
+		children = append(children, child)
+	}
+	sort.Strings(children)
+	return children, nil
+}
+
+// deleteLocked deletes the node and its container parents once they are empty. The store lock must be held
+func (s *Store) deleteLocked(nodePath string) error {
+	n, ok := s.nodes[nodePath]
+	if !ok {
+		return coordination.ErrNoNode
+	}
+	if len(n.children) > 0 {
+		return coordination.ErrNotEmpty
+	}
+	parentPath, name := path.Split(nodePath)
+	parentPath = parentDir(parentPath)
+	parent := s.nodes[parentPath]
+	s.revision++
+	delete(s.nodes, nodePath)
+	delete(parent.children, name)
+	parent.sequence++
+	s.fireLocked(s.existsWatches, nodePath, coordination.EventNodeDeleted)
+	s.fireLocked(s.childrenWatches, nodePath, coordination.EventNodeDeleted)
+	s.fireLocked(s.childrenWatches, parentPath, coordination.EventNodeChildrenChanged)
+	if parent.container && len(parent.children) == 0 {
+		return s.deleteLocked(parentPath)
+	}
+	return nil
+}
+
+// watchLocked sets a one-shot watch on the path. The store lock must be held
+func (s *Store) watchLocked(watches map[string][]watch, nodePath string, session *Session) <-chan coordination.Event {
+	events := make(chan coordination.Event, 1)
+	watches[nodePath] = append(watches[nodePath], watch{session: session, events: events})
+	return events
+}
+
+// fireLocked sends the event to the watches set on the path and removes them. The store lock must be held
+func (s *Store) fireLocked(watches map[string][]watch, nodePath string, eventType coordination.EventType) {
+	for _, w := range watches[nodePath] {
+		w.events <- coordination.Event{Type: eventType, Path: nodePath}
+		close(w.events)
+	}
+	delete(watches, nodePath)
+}
+
+// endSessionLocked deletes the ephemeral nodes of the session and stops its watches with the given error. The store lock must be held
+func (s *Store) endSessionLocked(session *Session, err error) {
+	for _, watches := range []map[string][]watch{s.existsWatches, s.childrenWatches} {
+		for nodePath, pathWatches := range watches {
+			kept := pathWatches[:0]
+			for _, w := range pathWatches {
+				if w.session != session {
+					kept = append(kept, w)
+					continue
+				}
+				w.events <- coordination.Event{Type: coordination.EventNotWatching, Path: nodePath, Err: err}
+				close(w.events)
+			}
+			watches[nodePath] = kept
+		}
+	}
+	var ephemerals []string
+	for nodePath, n := range s.nodes {
+		if n.owner == session {
+			ephemerals = append(ephemerals, nodePath)
+		}
+	}
+	for _, nodePath := range ephemerals {
+		// ephemeral nodes that were given children are kept, zookeeper does not allow them in the first place
+		_ = s.deleteLocked(nodePath)
+	}
+}
+
+// parentDir returns the path of the parent directory returned by path.Split without its trailing slash
+func parentDir(dir string) string {
+	if dir == "/" {
+		return dir
+	}
+	return strings.TrimSuffix(dir, "/")
+}
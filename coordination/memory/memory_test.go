@@ -0,0 +1,172 @@
+package memory_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/memory"
+)
+
+var _ = Describe("Memory store", func() {
+	var (
+		store  *memory.Store
+		first  coordination.Session
+		second coordination.Session
+		err    error
+	)
+
+	BeforeEach(func() {
+		store = memory.New()
+		first, err = store.Connect()
+		Expect(err).To(BeNil())
+		second, err = store.Connect()
+		Expect(err).To(BeNil())
+		_, err = first.Create("/election", []byte{}, coordination.Persistent)
+		Expect(err).To(BeNil())
+	})
+	AfterEach(func() {
+		first.Close()
+		second.Close()
+	})
+
+	It("must report the session as established right after Connect", func() {
+		Eventually(first.Events()).Should(Receive(Equal(coordination.Event{Type: coordination.EventSession, State: coordination.StateConnected})))
+		Eventually(first.Events()).Should(Receive(Equal(coordination.Event{Type: coordination.EventSession, State: coordination.StateHasSession})))
+	})
+
+	It("must suffix sequential nodes with an increasing counter", func() {
+		path, err := first.Create("/election/c_", []byte("a"), coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+		Expect(path).To(Equal("/election/c_0000000000"))
+		path, err = second.Create("/election/c_", []byte("b"), coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+		Expect(path).To(Equal("/election/c_0000000001"))
+		children, err := first.Children("/election")
+		Expect(err).To(BeNil())
+		Expect(children).To(Equal([]string{"c_0000000000", "c_0000000001"}))
+		data, _, err := second.Get("/election/c_0000000000")
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal([]byte("a")))
+	})
+
+	It("must refuse nodes without a parent and duplicated nodes", func() {
+		_, err = first.Create("/missing/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(MatchError(coordination.ErrNoNode))
+		_, err = second.Create("/election", []byte{}, coordination.Persistent)
+		Expect(err).To(MatchError(coordination.ErrNodeExists))
+		Expect(first.Delete("/")).To(MatchError(coordination.ErrNotEmpty))
+	})
+
+	It("must give increasing revisions to the created and modified nodes", func() {
+		_, err = first.Create("/election/a", []byte{}, coordination.Persistent)
+		Expect(err).To(BeNil())
+		_, err = first.Create("/election/b", []byte{}, coordination.Persistent)
+		Expect(err).To(BeNil())
+		_, a, err := first.Get("/election/a")
+		Expect(err).To(BeNil())
+		_, b, err := first.Get("/election/b")
+		Expect(err).To(BeNil())
+		Expect(b.CreateRevision).To(BeNumerically(">", a.CreateRevision))
+		modified, err := first.Set("/election/a", []byte("x"))
+		Expect(err).To(BeNil())
+		Expect(modified.CreateRevision).To(Equal(a.CreateRevision))
+		Expect(modified.ModRevision).To(BeNumerically(">", b.CreateRevision))
+	})
+
+	It("must fire a watch only once and close it", func() {
+		path, err := first.Create("/election/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+		exists, _, watch, err := second.ExistsW(path)
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeTrue())
+		_, err = first.Set(path, []byte("x"))
+		Expect(err).To(BeNil())
+		Expect(watch).To(Receive(Equal(coordination.Event{Type: coordination.EventNodeDataChanged, Path: path})))
+		Expect(watch).To(BeClosed())
+	})
+
+	It("must delete the ephemeral nodes and notify the watches when the session closes", func() {
+		path, err := first.Create("/election/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+		_, childrenWatch, err := second.ChildrenW("/election")
+		Expect(err).To(BeNil())
+		_, _, existsWatch, err := second.ExistsW(path)
+		Expect(err).To(BeNil())
+		first.Close()
+		Expect(existsWatch).To(Receive(Equal(coordination.Event{Type: coordination.EventNodeDeleted, Path: path})))
+		Expect(childrenWatch).To(Receive(Equal(coordination.Event{Type: coordination.EventNodeChildrenChanged, Path: "/election"})))
+		children, err := second.Children("/election")
+		Expect(err).To(BeNil())
+		Expect(children).To(BeEmpty())
+		Eventually(first.Events()).Should(BeClosed())
+	})
+
+	It("must delete a container with its last child", func() {
+		_, err = first.Create("/container", []byte{}, coordination.Container)
+		Expect(err).To(BeNil())
+		_, err = second.Create("/container/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+		second.Close()
+		exists, _, err := first.Exists("/container")
+		Expect(err).To(BeNil())
+		Expect(exists).To(BeFalse())
+	})
+
+	It("must fail the operations of a disconnected session until it reconnects", func() {
+		session := store.Sessions()[0]
+		session.Disconnect()
+		Eventually(first.Events()).Should(Receive(HaveField("State", coordination.StateDisconnected)))
+		_, err = first.Create("/election/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(MatchError(coordination.ErrClosed))
+		session.Reconnect()
+		Eventually(first.Events()).Should(Receive(HaveField("State", coordination.StateHasSession)))
+		_, err = first.Create("/election/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+	})
+
+	It("must fail the operations of a stalled session before the disconnect is reported", func() {
+		Eventually(first.Events()).Should(Receive(HaveField("State", coordination.StateHasSession)))
+		session := store.Sessions()[0]
+		session.Stall()
+		_, err = first.Create("/election/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(MatchError(coordination.ErrClosed))
+		Consistently(first.Events(), 100*time.Millisecond).ShouldNot(Receive())
+		session.Disconnect()
+		Eventually(first.Events()).Should(Receive(HaveField("State", coordination.StateDisconnected)))
+	})
+
+	It("must fail the operations of a session whose credentials are refused", func() {
+		store.Sessions()[0].FailAuth()
+		Eventually(first.Events()).Should(Receive(HaveField("State", coordination.StateAuthFailed)))
+		_, err = first.Create("/election/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(MatchError(coordination.ErrAuthFailed))
+	})
+
+	It("must count the watches until they fire", func() {
+		_, _, err = first.ChildrenW("/election")
+		Expect(err).To(BeNil())
+		_, _, _, err = second.ExistsW("/election")
+		Expect(err).To(BeNil())
+		Expect(store.Watches()).To(Equal(2))
+		_, err = first.Create("/election/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+		Expect(store.Watches()).To(Equal(1))
+	})
+
+	It("must delete the ephemeral nodes and stop the watches of an expired session", func() {
+		path, err := second.Create("/election/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+		_, _, ownWatch, err := second.ExistsW("/election/other")
+		Expect(err).To(BeNil())
+		_, _, otherWatch, err := first.ExistsW(path)
+		Expect(err).To(BeNil())
+		store.Sessions()[1].Expire()
+		Eventually(second.Events()).Should(Receive(HaveField("State", coordination.StateExpired)))
+		Expect(ownWatch).To(Receive(Equal(coordination.Event{Type: coordination.EventNotWatching, Path: "/election/other", Err: coordination.ErrSessionExpired})))
+		Expect(otherWatch).To(Receive(HaveField("Type", coordination.EventNodeDeleted)))
+		_, err = second.Children("/election")
+		Expect(err).To(MatchError(coordination.ErrSessionExpired))
+	})
+})
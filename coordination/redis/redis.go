@@ -0,0 +1,121 @@
+// Package redis is a lease lock on top of a single redis key
+// the lock is taken with a lua script that only counts a new token when it succeeds, and renewed and released with lua scripts that check the token,
+// so a stale holder can never touch the lock of the next one
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+)
+
+var (
+	// acquireScript takes the lock if it is free or already held by the holder and starts a new term
+	// the counter is only incremented when the lock is taken, so the tokens are not spent by the nodes that keep failing to get it
+	// a value that was not written by a LeaseLock has no holder and is left alone
+	acquireScript = goredis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if current then
+	local separator = string.find(current, ":", 1, true)
+	if not separator or string.sub(current, separator + 1) ~= ARGV[1] then
+		return 0
+	end
+end
+local token = redis.call("INCR", KEYS[2])
+redis.call("SET", KEYS[1], token .. ":" .. ARGV[1], "PX", ARGV[2])
+return token
+`)
+	// renewScript extends the lock if it still holds the value of the caller
+	renewScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+`)
+	// releaseScript deletes the lock if it still holds the value of the caller
+	releaseScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call("DEL", KEYS[1])
+`)
+)
+
+// LeaseLock is an election.LeaseLock stored in a redis key
+// the key holds the token and the holder, the token is taken from a counter incremented with INCR so it grows with every acquisition
+type LeaseLock struct {
+	client goredis.UniversalClient
+	// key is the key of the lock
+	key string
+	// tokenKey is the key of the counter of the fencing tokens, it never expires
+	tokenKey string
+}
+
+// New returns a lock stored in the given key, the fencing tokens are counted in the key suffixed with :token
+// both keys are used by the same script, so on a redis cluster the key must contain a hash tag, e.g. {my-service}-leader
+func New(client goredis.UniversalClient, key string) *LeaseLock {
+	return &LeaseLock{client: client, key: key, tokenKey: key + ":token"}
+}
+
+// value returns the content of the key for the holder and token
+func value(holder string, token int64) string {
+	return fmt.Sprintf("%d:%s", token, holder)
+}
+
+// TryAcquire takes the lock if the key does not exist or is held by the holder
+// the key expires by itself when the holder stops renewing it
+func (l *LeaseLock) TryAcquire(ctx context.Context, holder string, duration time.Duration) (int64, bool, error) {
+	token, err := acquireScript.Run(ctx, l.client, []string{l.key, l.tokenKey}, holder, duration.Milliseconds()).Int64()
+	if err != nil {
+		return 0, false, err
+	}
+	return token, token != 0, nil
+}
+
+// Renew extends the expiry of the key if it still holds the holder and token
+func (l *LeaseLock) Renew(ctx context.Context, holder string, token int64, duration time.Duration) error {
+	renewed, err := renewScript.Run(ctx, l.client, []string{l.key}, value(holder, token), duration.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if renewed != 1 {
+		return election.ErrLeaseLost
+	}
+	return nil
+}
+
+// Release deletes the key if it still holds the holder and token
+func (l *LeaseLock) Release(ctx context.Context, holder string, token int64) error {
+	released, err := releaseScript.Run(ctx, l.client, []string{l.key}, value(holder, token)).Int()
+	if err != nil {
+		return err
+	}
+	if released != 1 {
+		return election.ErrLeaseLost
+	}
+	return nil
+}
+
+// Holder returns the holder of the lock and its token, it returns election.ErrNoLeader if the lock is free
+func (l *LeaseLock) Holder(ctx context.Context) (string, int64, error) {
+	current, err := l.client.Get(ctx, l.key).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", 0, election.ErrNoLeader
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	tokenString, holder, _ := strings.Cut(current, ":")
+	token, err := strconv.ParseInt(tokenString, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid lock value %q: %w", current, err)
+	}
+	return holder, token, nil
+}
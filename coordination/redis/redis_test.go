@@ -0,0 +1,159 @@
+package redis_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	goredis "github.com/redis/go-redis/v9"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/redis"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+)
+
+const lockKey = "election"
+
+var _ = Describe("Redis lease election", func() {
+	var (
+		server     *miniredis.Miniredis
+		client     *goredis.Client
+		lock       *redis.LeaseLock
+		ctx        context.Context
+		cancel     context.CancelFunc
+		candidates []*election.LeaseElection
+		cancels    []context.CancelFunc
+		err        error
+	)
+
+	// start runs a candidate and waits for it to know where it stands
+	start := func(id string) *election.LeaseElection {
+		candidate := &election.LeaseElection{
+			Lock:          lock,
+			ID:            id,
+			LeaseDuration: time.Second,
+			RenewDeadline: 600 * time.Millisecond,
+			RetryPeriod:   100 * time.Millisecond,
+		}
+		candidateCtx, candidateCancel := context.WithCancel(ctx)
+		candidates = append(candidates, candidate)
+		cancels = append(cancels, candidateCancel)
+		go candidate.Run(candidateCtx)
+		Eventually(candidate.State).Should(BeElementOf(election.Leader, election.Follower))
+		return candidate
+	}
+
+	BeforeEach(func() {
+		server, err = miniredis.Run()
+		Expect(err).To(BeNil())
+		client = goredis.NewClient(&goredis.Options{Addr: server.Addr()})
+		lock = redis.New(client, lockKey)
+		candidates, cancels = nil, nil
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+	AfterEach(func() {
+		cancel()
+		for _, candidate := range candidates {
+			Eventually(candidate.State).Should(Equal(election.Stopped))
+		}
+		client.Close()
+		server.Close()
+	})
+
+	It("must elect the first candidate and expose its fencing token", func() {
+		first := start("first")
+		second := start("second")
+		Expect(first.IsLeader()).To(BeTrue())
+		Expect(second.State()).To(Equal(election.Follower))
+		token, ok := first.FencingToken()
+		Expect(ok).To(BeTrue())
+		holder, holderToken, err := lock.Holder(ctx)
+		Expect(err).To(BeNil())
+		Expect(holder).To(Equal("first"))
+		Expect(holderToken).To(Equal(token))
+		Consistently(second.IsLeader, 1500*time.Millisecond).Should(BeFalse())
+	})
+
+	It("must release the lock on cancel so that the next candidate takes over with a bigger token", func() {
+		first := start("first")
+		second := start("second")
+		firstToken, _ := first.FencingToken()
+		cancels[0]()
+		Eventually(first.State).Should(Equal(election.Stopped))
+		Eventually(second.IsLeader, 500*time.Millisecond).Should(BeTrue())
+		secondToken, _ := second.FencingToken()
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+	})
+
+	It("must take over once the lock of a dead holder expires", func() {
+		_, ok, err := lock.TryAcquire(ctx, "ghost", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+		candidate := start("candidate")
+		Expect(candidate.State()).To(Equal(election.Follower))
+		Consistently(candidate.IsLeader, 300*time.Millisecond).Should(BeFalse())
+		// miniredis only expires the keys when its clock is moved forward
+		server.FastForward(time.Second)
+		Eventually(candidate.IsLeader).Should(BeTrue())
+	})
+
+	It("must step down when the lock is taken by someone else", func() {
+		candidate := start("candidate")
+		Expect(candidate.IsLeader()).To(BeTrue())
+		Expect(server.Set(lockKey, "99:thief")).To(Succeed())
+		Eventually(candidate.State).Should(Equal(election.Follower))
+	})
+
+	It("must step down when redis cannot be reached before the renew deadline and come back after", func() {
+		candidate := start("candidate")
+		Expect(candidate.IsLeader()).To(BeTrue())
+		firstToken, _ := candidate.FencingToken()
+		server.Close()
+		Eventually(candidate.State).Should(Equal(election.Disconnected))
+		Expect(server.Restart()).To(Succeed())
+		Eventually(candidate.IsLeader).Should(BeTrue())
+		secondToken, _ := candidate.FencingToken()
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+	})
+
+	It("must refuse to renew or release the lock under another token", func() {
+		token, ok, err := lock.TryAcquire(ctx, "candidate", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+		_, ok, err = lock.TryAcquire(ctx, "other", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeFalse())
+		Expect(lock.Renew(ctx, "candidate", token+1, time.Second)).To(MatchError(election.ErrLeaseLost))
+		Expect(lock.Release(ctx, "other", token)).To(MatchError(election.ErrLeaseLost))
+		Expect(lock.Renew(ctx, "candidate", token, 2*time.Second)).To(Succeed())
+		Expect(server.TTL(lockKey)).To(Equal(2 * time.Second))
+		Expect(lock.Release(ctx, "candidate", token)).To(Succeed())
+		_, _, err = lock.Holder(ctx)
+		Expect(err).To(MatchError(election.ErrNoLeader))
+	})
+
+	It("must only count a new token when the lock is taken", func() {
+		token, ok, err := lock.TryAcquire(ctx, "candidate", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+		for i := 0; i < 5; i++ {
+			_, ok, err = lock.TryAcquire(ctx, "other", time.Second)
+			Expect(err).To(BeNil())
+			Expect(ok).To(BeFalse())
+		}
+		Expect(lock.Release(ctx, "candidate", token)).To(Succeed())
+		next, ok, err := lock.TryAcquire(ctx, "other", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeTrue())
+		Expect(next).To(Equal(token + 1))
+	})
+
+	It("must leave alone a key that was not written by a lock", func() {
+		Expect(server.Set(lockKey, "foreign")).To(Succeed())
+		_, ok, err := lock.TryAcquire(ctx, "candidate", time.Second)
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeFalse())
+		Expect(server.Get(lockKey)).To(Equal("foreign"))
+	})
+})
@@ -0,0 +1,225 @@
+package zookeeper
+
+import (
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
+)
+
+// Credentials are added to every session with AddAuth, the zookeeper client submits them again every time it reconnects
+type Credentials struct {
+	// Scheme is the authentication scheme, for example digest
+	Scheme string
+	// Auth is the scheme specific authentication data, for example user:password for digest
+	Auth []byte
+}
+
+// Config is the configuration of the zookeeper backend
+type Config struct {
+	// Servers is a list of zookeeper servers
+	Servers []string
+	// SessionTimeout is the timeout for the zookeeper connection and the session
+	SessionTimeout time.Duration
+	// TLS is the configuration used to encrypt the connection. If it is not provided, the connection is plain TCP
+	TLS *utils.TLSConfig
+	// Credentials are added to every session
+	Credentials []Credentials
+	// ACL returns the ACL of the znode created at the given path. The default value gives all permissions to everyone
+	ACL func(path string) []zk.ACL
+}
+
+// Backend opens zookeeper sessions
+type Backend struct {
+	config Config
+}
+
+// New returns a zookeeper backend with the given configuration
+func New(config Config) *Backend {
+	if config.ACL == nil {
+		config.ACL = func(string) []zk.ACL {
+			return zk.WorldACL(zk.PermAll)
+		}
+	}
+	return &Backend{config: config}
+}
+
+// Connect connects to zookeeper and authenticates the session
+func (b *Backend) Connect() (coordination.Session, error) {
+	dialer, err := utils.Dialer(b.config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	conn, events, err := zk.Connect(b.config.Servers, b.config.SessionTimeout, zk.WithDialer(dialer))
+	if err != nil {
+		return nil, err
+	}
+	for _, credentials := range b.config.Credentials {
+		err = conn.AddAuth(credentials.Scheme, credentials.Auth)
+		if err != nil {
+			conn.Close()
+			return nil, convertError(err)
+		}
+	}
+	s := &session{
+		conn:   conn,
+		acl:    b.config.ACL,
+		events: make(chan coordination.Event, cap(events)),
+	}
+	go func() {
+		defer close(s.events)
+		for event := range events {
+			s.events <- convertEvent(event)
+		}
+	}()
+	return s, nil
+}
+
+// session is a coordination.Session on top of a zookeeper connection
+type session struct {
+	conn   *zk.Conn
+	acl    func(path string) []zk.ACL
+	events chan coordination.Event
+}
+
+func (s *session) Create(path string, data []byte, mode coordination.CreateMode) (string, error) {
+	var created string
+	var err error
+	switch mode {
+	case coordination.Container:
+		// the container create mode has the same value as the TTL flag in the zookeeper protocol
+		created, err = s.conn.CreateContainer(path, data, zk.FlagTTL, s.acl(path))
+	case coordination.Ephemeral:
+		created, err = s.conn.Create(path, data, zk.FlagEphemeral, s.acl(path))
+	case coordination.EphemeralSequential:
+		created, err = s.conn.Create(path, data, zk.FlagEphemeral|zk.FlagSequence, s.acl(path))
+	default:
+		created, err = s.conn.Create(path, data, 0, s.acl(path))
+	}
+	return created, convertError(err)
+}
+
+func (s *session) Delete(path string) error {
+	return convertError(s.conn.Delete(path, -1))
+}
+
+func (s *session) Exists(path string) (bool, coordination.Stat, error) {
+	exists, stat, err := s.conn.Exists(path)
+	return exists, convertStat(stat), convertError(err)
+}
+
+func (s *session) ExistsW(path string) (bool, coordination.Stat, <-chan coordination.Event, error) {
+	exists, stat, watch, err := s.conn.ExistsW(path)
+	if err != nil {
+		return false, coordination.Stat{}, nil, convertError(err)
+	}
+	return exists, convertStat(stat), convertWatch(watch), nil
+}
+
+func (s *session) Get(path string) ([]byte, coordination.Stat, error) {
+	data, stat, err := s.conn.Get(path)
+	return data, convertStat(stat), convertError(err)
+}
+
+func (s *session) Set(path string, data []byte) (coordination.Stat, error) {
+	stat, err := s.conn.Set(path, data, -1)
+	return convertStat(stat), convertError(err)
+}
+
+func (s *session) Children(path string) ([]string, error) {
+	children, _, err := s.conn.Children(path)
+	return children, convertError(err)
+}
+
+func (s *session) ChildrenW(path string) ([]string, <-chan coordination.Event, error) {
+	children, _, watch, err := s.conn.ChildrenW(path)
+	if err != nil {
+		return nil, nil, convertError(err)
+	}
+	return children, convertWatch(watch), nil
+}
+
+func (s *session) Events() <-chan coordination.Event {
+	return s.events
+}
+
+func (s *session) Close() {
+	s.conn.Close()
+}
+
+// convertWatch translates the single event of a zookeeper watch
+func convertWatch(watch <-chan zk.Event) <-chan coordination.Event {
+	converted := make(chan coordination.Event, 1)
+	go func() {
+		defer close(converted)
+		for event := range watch {
+			converted <- convertEvent(event)
+		}
+	}()
+	return converted
+}
+
+// convertEvent translates a zookeeper event
+func convertEvent(event zk.Event) coordination.Event {
+	converted := coordination.Event{Path: event.Path, Err: convertError(event.Err)}
+	switch event.Type {
+	case zk.EventNodeCreated:
+		converted.Type = coordination.EventNodeCreated
+	case zk.EventNodeDeleted:
+		converted.Type = coordination.EventNodeDeleted
+	case zk.EventNodeDataChanged:
+		converted.Type = coordination.EventNodeDataChanged
+	case zk.EventNodeChildrenChanged:
+		converted.Type = coordination.EventNodeChildrenChanged
+	case zk.EventNotWatching:
+		converted.Type = coordination.EventNotWatching
+	default:
+		converted.Type = coordination.EventSession
+	}
+	switch event.State {
+	case zk.StateDisconnected:
+		converted.State = coordination.StateDisconnected
+	case zk.StateConnecting:
+		converted.State = coordination.StateConnecting
+	case zk.StateConnected:
+		converted.State = coordination.StateConnected
+	case zk.StateHasSession:
+		converted.State = coordination.StateHasSession
+	case zk.StateExpired:
+		converted.State = coordination.StateExpired
+	case zk.StateAuthFailed:
+		converted.State = coordination.StateAuthFailed
+	}
+	return converted
+}
+
+// convertStat translates the metadata of a znode
+func convertStat(stat *zk.Stat) coordination.Stat {
+	if stat == nil {
+		return coordination.Stat{}
+	}
+	return coordination.Stat{CreateRevision: stat.Czxid, ModRevision: stat.Mzxid}
+}
+
+// convertError translates the zookeeper errors that the algorithms act upon
+func convertError(err error) error {
+	switch err {
+	case zk.ErrNoNode:
+		return coordination.ErrNoNode
+	case zk.ErrNodeExists:
+		return coordination.ErrNodeExists
+	case zk.ErrNotEmpty:
+		return coordination.ErrNotEmpty
+	case zk.ErrNoAuth:
+		return coordination.ErrNoAuth
+	case zk.ErrSessionExpired:
+		return coordination.ErrSessionExpired
+	case zk.ErrAuthFailed:
+		return coordination.ErrAuthFailed
+	case zk.ErrClosing, zk.ErrConnectionClosed:
+		return coordination.ErrClosed
+	default:
+		return err
+	}
+}
@@ -0,0 +1,34 @@
+package election
+
+import (
+	"github.com/go-zookeeper/zk"
+)
+
+// DigestCredentials are the user and password of the zookeeper digest authentication scheme
+type DigestCredentials struct {
+	// User is the name of the service principal
+	User string
+	// Password is the password of the service principal
+	Password string
+}
+
+// ACLProvider returns the ACL of the znode the election creates at the given path
+// it is used for the candidate znodes and for the namespace when it is created and NamespaceACL is not set
+// note that zookeeper checks the delete permission of the parent, so the namespace ACL is what protects the candidate znodes from being deleted
+type ACLProvider func(path string) []zk.ACL
+
+// WorldACLProvider gives the given permissions to everyone on every znode
+func WorldACLProvider(perms int32) ACLProvider {
+	return func(string) []zk.ACL {
+		return zk.WorldACL(perms)
+	}
+}
+
+// DigestACLProvider gives all permissions to the service principal and read permission to everyone else
+// so that observers and tools can still find the leader without being able to change the election
+func DigestACLProvider(credentials DigestCredentials) ACLProvider {
+	return func(string) []zk.ACL {
+		acl := zk.DigestACL(zk.PermAll, credentials.User, credentials.Password)
+		return append(acl, zk.WorldACL(zk.PermRead)...)
+	}
+}
@@ -0,0 +1,56 @@
+package election
+
+import (
+	"strings"
+
+	"github.com/go-zookeeper/zk"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/zookeeper"
+)
+
+// backend returns the coordination backend of the election
+// when Backend is not set, it is a zookeeper backend built from the zookeeper fields
+func (l *LeaderElection) backend() coordination.Backend {
+	if l.Backend != nil {
+		return l.Backend
+	}
+	return zookeeper.New(zookeeper.Config{
+		Servers:        l.Zookeepers,
+		SessionTimeout: l.ZkTimeout,
+		TLS:            l.TLS,
+		Credentials:    digestCredentials(l.DigestAuth),
+		ACL:            l.acl,
+	})
+}
+
+// acl returns the ACL of the znode created at the given path
+// the namespace and its parents get NamespaceACL when it is set, everything else gets the ACL of the ACLProvider
+func (l *LeaderElection) acl(path string) []zk.ACL {
+	if l.NamespaceACL != nil && strings.HasPrefix(l.ZkNamespace+"/", path+"/") {
+		return l.NamespaceACL
+	}
+	return l.ACLProvider(path)
+}
+
+// backend returns the coordination backend of the observer
+// when Backend is not set, it is a zookeeper backend built from the zookeeper fields
+func (o *Observer) backend() coordination.Backend {
+	if o.Backend != nil {
+		return o.Backend
+	}
+	return zookeeper.New(zookeeper.Config{
+		Servers:        o.Zookeepers,
+		SessionTimeout: o.ZkTimeout,
+		TLS:            o.TLS,
+		Credentials:    digestCredentials(o.DigestAuth),
+	})
+}
+
+// digestCredentials returns the digest credentials in the form expected by the zookeeper backend
+// the zookeeper client remembers them and submits them again every time it reconnects
+func digestCredentials(credentials *DigestCredentials) []zookeeper.Credentials {
+	if credentials == nil {
+		return nil
+	}
+	return []zookeeper.Credentials{{Scheme: "digest", Auth: []byte(credentials.User + ":" + credentials.Password)}}
+}
@@ -0,0 +1,160 @@
+package election
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
+)
+
+// CandidateInfo is the identity of a candidate. It is stored json encoded in the candidate znode
+type CandidateInfo struct {
+	// Znode is the name of the candidate znode in the namespace, it is not part of the payload
+	Znode string `json:"-"`
+	// ID is the unique identifier of the candidate
+	ID string `json:"id"`
+	// Hostname is the hostname of the machine the candidate runs on
+	Hostname string `json:"hostname"`
+	// Address is the advertised address of the candidate
+	Address string `json:"address,omitempty"`
+	// StartTime is the time at which the candidate started
+	StartTime time.Time `json:"startTime"`
+	// Version is the version of the program the candidate runs
+	Version string `json:"version,omitempty"`
+	// Priority is the priority of the candidate, the live candidate with the highest priority becomes the leader
+	Priority int `json:"priority,omitempty"`
+	// Elected is set by the candidate once it has won the election, it tells the leader apart from a first candidate that is about to let a candidate with a higher priority go first
+	Elected bool `json:"elected,omitempty"`
+}
+
+// candidateInfo returns the identity of the current node
+func (l *LeaderElection) candidateInfo() CandidateInfo {
+	hostname, err := utils.GetHostname()
+	if err != nil {
+		l.Log.Info().Err(err).Msg("Failed to get hostname")
+	}
+	return CandidateInfo{
+		ID:        l.ID,
+		Hostname:  hostname,
+		Address:   l.AdvertisedAddress,
+		StartTime: l.startTime,
+		Version:   l.Version,
+		Priority:  l.Priority,
+	}
+}
+
+// markElected publishes in the candidate znode that the current node has won the election
+func (l *LeaderElection) markElected() error {
+	info := l.candidateInfo()
+	info.Elected = true
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	_, err = l.conn.Set(l.ZkNamespace+"/"+l.currentZnodeName, data)
+	if err == coordination.ErrNoNode {
+		return ErrCandidacyLost
+	}
+	return err
+}
+
+// decodeCandidateInfo decodes the payload of a candidate znode
+// znodes created without a payload are returned with only their name set
+func decodeCandidateInfo(znode string, data []byte) (CandidateInfo, error) {
+	info := CandidateInfo{}
+	if len(data) > 0 {
+		err := json.Unmarshal(data, &info)
+		if err != nil {
+			return CandidateInfo{}, fmt.Errorf("failed to decode candidate %s: %w", znode, err)
+		}
+	}
+	info.Znode = znode
+	return info, nil
+}
+
+// connection returns the current session with the coordination store
+func (l *LeaderElection) connection() (coordination.Session, error) {
+	l.connMu.Lock()
+	defer l.connMu.Unlock()
+	if l.conn == nil {
+		return nil, ErrNotRunning
+	}
+	return l.conn, nil
+}
+
+// Candidates returns the identity of all the candidates in the order of their sequence
+// the first one is the leader unless it is about to let a candidate with a higher priority go first, GetLeader tells which one leads
+func (l *LeaderElection) Candidates() ([]CandidateInfo, error) {
+	conn, err := l.connection()
+	if err != nil {
+		return nil, err
+	}
+	return listCandidates(conn, l.ZkNamespace)
+}
+
+// GetLeader returns the identity of the current leader
+// it returns ErrNoLeader if there are no candidates or if the first one is about to let a candidate with a higher priority go first
+func (l *LeaderElection) GetLeader() (CandidateInfo, error) {
+	candidates, err := l.Candidates()
+	if err != nil {
+		return CandidateInfo{}, err
+	}
+	leader, ok := leaderOf(candidates)
+	if !ok {
+		return CandidateInfo{}, ErrNoLeader
+	}
+	return leader, nil
+}
+
+// leaderOf returns the leader among the candidates sorted by sequence and false if there is none yet
+// the first candidate keeps the leadership once it has won the election, before that it only wins if nobody behind it has a higher priority
+func leaderOf(candidates []CandidateInfo) (CandidateInfo, bool) {
+	if len(candidates) == 0 {
+		return CandidateInfo{}, false
+	}
+	first := candidates[0]
+	if first.Elected {
+		return first, true
+	}
+	for _, candidate := range candidates[1:] {
+		if candidate.Priority > first.Priority {
+			return CandidateInfo{}, false
+		}
+	}
+	return first, true
+}
+
+// listCandidates reads the identity of all the candidates in the namespace, sorted by sequence
+// candidates that go away while they are being read are skipped
+func listCandidates(conn coordination.Session, namespace string) ([]CandidateInfo, error) {
+	children, err := conn.Children(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return readCandidates(conn, namespace, children)
+}
+
+// readCandidates reads the identity of the given children of the namespace, sorted by sequence
+// candidates that go away while they are being read are skipped
+func readCandidates(conn coordination.Session, namespace string, children []string) ([]CandidateInfo, error) {
+	sort.Strings(children)
+	candidates := make([]CandidateInfo, 0, len(children))
+	for _, child := range children {
+		data, _, err := conn.Get(namespace + "/" + child)
+		if err == coordination.ErrNoNode {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		info, err := decodeCandidateInfo(child, data)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, info)
+	}
+	return candidates, nil
+}
@@ -1,16 +1,21 @@
 package election
 
 import (
-	"context"
+	"time"
 
 	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/go-zookeeper/zk"
 	"github.com/rs/zerolog/log"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
 )
 
 // DefaultConfig initialized some recommended default values for leaderElection
-// You shouldn't need to call this yourself as its called in StartLoopElection
+// You shouldn't need to call this yourself as its called in Run
 // backoff is set to exponential backoff with randonmess and infinite retry
 // log is set to default zero log logger
+// acl provider is set to all permissions for everyone
+// id is set to a unique identifier based on the hostname
+// fence timeout is set to half of the zookeeper timeout when the FenceOnDisconnect policy is used
 func (l *LeaderElection) defaultConfig() {
 	if l.Backoff == nil {
 		bckoff := backoff.NewExponentialBackOff()
@@ -18,8 +23,24 @@ func (l *LeaderElection) defaultConfig() {
 		bckoff.MaxElapsedTime = 0
 		l.Backoff = bckoff
 	}
+	if l.DisconnectPolicy == FenceOnDisconnect && l.FenceTimeout == 0 {
+		l.FenceTimeout = l.ZkTimeout / 2
+	}
+	if l.ACLProvider == nil {
+		l.ACLProvider = WorldACLProvider(zk.PermAll)
+	}
 	if l.Log == nil {
 		l.Log = &log.Logger
 	}
-	l.Ctx, l.Cancel = context.WithCancel(context.Background())
+	if l.ID == "" {
+		id, err := utils.GetUniqueIdentifier()
+		if err != nil {
+			l.Log.Info().Err(err).Msg("Failed to get hostname for the identifier")
+			id = utils.RandomString(10)
+		}
+		l.ID = id
+	}
+	if l.startTime.IsZero() {
+		l.startTime = time.Now()
+	}
 }
@@ -0,0 +1,91 @@
+package election
+
+import (
+	"context"
+	"time"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+)
+
+// DisconnectPolicy decides what happens to the leadership when the connection to zookeeper is lost
+// Whatever the policy, an expired session always drops the leadership and restarts the candidacy from scratch
+type DisconnectPolicy int
+
+const (
+	// StepDownOnDisconnect drops the leadership as soon as the connection is lost and restarts the candidacy on a new connection
+	StepDownOnDisconnect DisconnectPolicy = iota
+	// KeepLeadershipOnDisconnect keeps the leadership while the connection is lost as long as it comes back within the session timeout
+	// Note that the session may expire on the server slightly before the client notices, so another node can become leader while this one still is
+	KeepLeadershipOnDisconnect
+	// FenceOnDisconnect keeps the leadership while the connection is lost but steps down FenceTimeout after the last successful contact with the server
+	// the client only reports a disconnect after hearing nothing for a while, so the leader checks its znode every quarter of FenceTimeout and times the fence from the last answer
+	// the session cannot expire before ZkTimeout after that answer, so the leader steps down before another node can be elected
+	// if the connection comes back with the same session, the node takes its place in the election back
+	FenceOnDisconnect
+)
+
+// String returns the name of the policy
+func (p DisconnectPolicy) String() string {
+	switch p {
+	case StepDownOnDisconnect:
+		return "StepDownOnDisconnect"
+	case KeepLeadershipOnDisconnect:
+		return "KeepLeadershipOnDisconnect"
+	case FenceOnDisconnect:
+		return "FenceOnDisconnect"
+	default:
+		return "Unknown"
+	}
+}
+
+// leadershipGracePeriod returns how much longer a disconnected leader keeps the leadership
+// with FenceOnDisconnect it is timed from the last successful contact with the server rather than from the moment the disconnect is reported
+func (l *LeaderElection) leadershipGracePeriod() time.Duration {
+	if l.DisconnectPolicy == FenceOnDisconnect {
+		remaining := time.Until(time.Unix(0, l.lastContact.Load()).Add(l.FenceTimeout))
+		if remaining < 0 {
+			return 0
+		}
+		return remaining
+	}
+	return l.ZkTimeout
+}
+
+// recordContact records that the server answered a request sent at the given time
+func (l *LeaderElection) recordContact(sent time.Time) {
+	for {
+		last := l.lastContact.Load()
+		if sent.UnixNano() <= last || l.lastContact.CompareAndSwap(last, sent.UnixNano()) {
+			return
+		}
+	}
+}
+
+// probeContact checks the znode of the leader every quarter of FenceTimeout until ctx is done and records the answers
+// it runs in its own goroutine since the requests block while the connection is lost
+func (l *LeaderElection) probeContact(ctx context.Context, conn coordination.Session, znode string) {
+	ticker := time.NewTicker(l.FenceTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sent := time.Now()
+		_, _, err := conn.Exists(znode)
+		if err == nil {
+			l.recordContact(sent)
+		}
+	}
+}
+
+// stopTimer stops the timer and drains its channel so that it can be safely reset
+func stopTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+}
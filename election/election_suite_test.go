@@ -1,6 +1,18 @@
 package election_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -8,13 +20,18 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/format"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/zookeeper"
 	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
 )
 
 var (
 	Namespace  = "/election"
 	Zookeepers = []string{"127.0.0.1:2181"}
 	Timeout    = time.Second * 2
+	// zookeeperReachable tells if a zookeeper server listens on Zookeepers, the specs labelled zookeeper are skipped otherwise
+	zookeeperReachable bool
 )
 
 func TestTask(t *testing.T) {
@@ -24,8 +41,20 @@ func TestTask(t *testing.T) {
 
 var _ = BeforeSuite(func() {
 	format.MaxLength = 0
+	conn, err := net.DialTimeout("tcp", Zookeepers[0], time.Second)
+	if err == nil {
+		conn.Close()
+		zookeeperReachable = true
+	}
 })
 
+// requireZookeeper skips the current spec when no zookeeper server is reachable, the behaviour of the election is covered by the in-memory specs
+func requireZookeeper() {
+	if !zookeeperReachable {
+		Skip("zookeeper is not reachable at " + Zookeepers[0])
+	}
+}
+
 func deleteZNodeRecursively(conn *zk.Conn, path string) error {
 	children, _, _ := conn.Children(path)
 
@@ -52,19 +81,121 @@ func defaultLeaderElection() *election.LeaderElection {
 func createCandidates(number int) []*election.LeaderElection {
 	var candidates []*election.LeaderElection
 	var candidate *election.LeaderElection
-	var connection *zk.Conn
-	var watcher <-chan zk.Event
+	var session coordination.Session
 	var err error
 	for number > 0 {
 		candidate = defaultLeaderElection()
-		connection, watcher, err = zk.Connect(candidate.Zookeepers, candidate.ZkTimeout)
+		session, err = zookeeper.New(zookeeper.Config{Servers: candidate.Zookeepers, SessionTimeout: candidate.ZkTimeout}).Connect()
 		if err != nil {
 			panic(err)
 		}
-		candidate.SetConn(connection)
-		candidate.SetWatcher(watcher)
+		candidate.SetSession(session)
 		candidates = append(candidates, candidate)
 		number -= 1
 	}
 	return candidates
 }
+
+// writeCertificate signs a certificate for the template with the parent certificate and writes it and its key as PEM files in dir
+func writeCertificate(dir, name string, template, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		panic(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		panic(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	if err != nil {
+		panic(err)
+	}
+	err = os.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	if err != nil {
+		panic(err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	return certificate, key
+}
+
+// startTLSProxy starts a proxy that terminates mutual TLS and forwards the traffic to the zookeeper server
+// it returns the address of the proxy and the client side TLS configuration
+func startTLSProxy(dir string) (string, *utils.TLSConfig, func()) {
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := time.Now().Add(time.Hour)
+	ca, caKey := writeCertificate(dir, "ca", &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "election test CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil, nil)
+	writeCertificate(dir, "server", &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "zookeeper"},
+		DNSNames:     []string{"zookeeper"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, caKey)
+	writeCertificate(dir, "client", &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "election"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, ca, caKey)
+
+	serverCertificate, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"))
+	if err != nil {
+		panic(err)
+	}
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{serverCertificate},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	if err != nil {
+		panic(err)
+	}
+	go func() {
+		for {
+			client, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer client.Close()
+				server, err := net.Dial("tcp", Zookeepers[0])
+				if err != nil {
+					return
+				}
+				defer server.Close()
+				go io.Copy(server, client)
+				io.Copy(client, server)
+			}()
+		}
+	}()
+	return listener.Addr().String(), &utils.TLSConfig{
+		CAFile:     filepath.Join(dir, "ca.pem"),
+		CertFile:   filepath.Join(dir, "client.pem"),
+		KeyFile:    filepath.Join(dir, "client-key.pem"),
+		ServerName: "zookeeper",
+	}, func() { listener.Close() }
+}
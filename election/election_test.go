@@ -1,16 +1,21 @@
 package election_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/go-zookeeper/zk"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
 	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
 )
 
-var _ = Describe("Election", func() {
+var _ = Describe("Election", Label("zookeeper"), func() {
 	var (
 		leaderElection *election.LeaderElection
 		conn           *zk.Conn
@@ -21,6 +26,7 @@ var _ = Describe("Election", func() {
 	)
 
 	BeforeEach(func() {
+		requireZookeeper()
 		//connect to zookeeper and create the namespace
 		conn, _, err = zk.Connect(Zookeepers, Timeout)
 		if err != nil {
@@ -63,7 +69,7 @@ var _ = Describe("Election", func() {
 				panic(err)
 			}
 			Expect(len(children)).To(Equal(1))
-			Expect(leaderElection.IsLeader).To(BeTrue())
+			Expect(leaderElection.IsLeader()).To(BeTrue())
 		})
 	})
 
@@ -89,7 +95,677 @@ var _ = Describe("Election", func() {
 				panic(err)
 			}
 			Expect(len(children)).To(Equal(1))
-			Expect(leaderElection.IsLeader).To(BeTrue())
+			Expect(leaderElection.IsLeader()).To(BeTrue())
+		})
+	})
+
+	Describe("One running instance with leadership callbacks", func() {
+		var (
+			elected chan context.Context
+			revoked chan struct{}
+		)
+		BeforeEach(func() {
+			elected = make(chan context.Context, 1)
+			revoked = make(chan struct{}, 1)
+			leaderElection = defaultLeaderElection()
+			leaderElection.OnElected = func(ctx context.Context) {
+				elected <- ctx
+			}
+			leaderElection.OnRevoked = func() {
+				revoked <- struct{}{}
+			}
+			err = leaderElection.StartElectionLoopWithoutFailureReties()
+			if err != nil {
+				panic(err)
+			}
+		})
+		AfterEach(func() {
+			leaderElection.Cancel()
+		})
+		It("must call OnElected when elected and cancel its context before calling OnRevoked", func() {
+			var leaderCtx context.Context
+			Eventually(elected, Timeout).Should(Receive(&leaderCtx))
+			Expect(leaderCtx.Err()).To(BeNil())
+			token, ok := election.FencingTokenFromContext(leaderCtx)
+			Expect(ok).To(BeTrue())
+			currentToken, ok := leaderElection.FencingToken()
+			Expect(ok).To(BeTrue())
+			Expect(currentToken).To(Equal(token))
+			Consistently(revoked).ShouldNot(Receive())
+			leaderElection.Cancel()
+			Eventually(revoked, Timeout).Should(Receive())
+			Expect(leaderCtx.Err()).To(Equal(context.Canceled))
+		})
+	})
+
+	Describe("Leadership state of a single running instance", func() {
+		BeforeEach(func() {
+			leaderElection = defaultLeaderElection()
+			Expect(leaderElection.State()).To(Equal(election.Disconnected))
+			err = leaderElection.StartElectionLoopWithFailureRetries()
+			if err != nil {
+				panic(err)
+			}
+		})
+		AfterEach(func() {
+			leaderElection.Cancel()
+		})
+		It("must wait for the leadership and report Stopped once cancelled", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+			defer cancel()
+			Expect(leaderElection.WaitForLeadership(ctx)).To(Succeed())
+			Expect(leaderElection.State()).To(Equal(election.Leader))
+			Expect(leaderElection.IsLeader()).To(BeTrue())
+			leaderElection.Cancel()
+			Eventually(leaderElection.State, Timeout).Should(Equal(election.Stopped))
+			Expect(leaderElection.IsLeader()).To(BeFalse())
+			Expect(leaderElection.WaitForLeadership(context.Background())).To(MatchError(election.ErrElectionStopped))
+		})
+	})
+
+	Describe("Two candidates waiting for the leadership", func() {
+		BeforeEach(func() {
+			candidates = createCandidates(2)
+			for _, candidate := range candidates {
+				err = candidate.Candidate()
+				if err != nil {
+					panic(err)
+				}
+				Expect(candidate.State()).To(Equal(election.Candidate))
+				err = candidate.ReelectLeader()
+				if err != nil {
+					panic(err)
+				}
+				go candidate.ProcessEvents()
+			}
+		})
+		AfterEach(func() {
+			for _, candidate := range candidates {
+				candidate.Cancel()
+				candidate.CloseConn()
+			}
+		})
+		It("must unblock the follower once the leader is gone", func() {
+			Expect(candidates[0].State()).To(Equal(election.Leader))
+			Expect(candidates[1].State()).To(Equal(election.Follower))
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+			defer cancel()
+			Expect(candidates[1].WaitForLeadership(ctx)).To(MatchError(context.DeadlineExceeded))
+			candidates[0].Cancel()
+			candidates[0].CloseConn()
+			ctx, cancel = context.WithTimeout(context.Background(), Timeout*2)
+			defer cancel()
+			Expect(candidates[1].WaitForLeadership(ctx)).To(Succeed())
+		})
+	})
+
+	Describe("Fencing tokens across leadership terms", func() {
+		BeforeEach(func() {
+			candidates = createCandidates(3)
+			for _, candidate := range candidates {
+				err = candidate.Candidate()
+				if err != nil {
+					panic(err)
+				}
+				err = candidate.ReelectLeader()
+				if err != nil {
+					panic(err)
+				}
+				go candidate.ProcessEvents()
+			}
+		})
+		AfterEach(func() {
+			for _, candidate := range candidates {
+				candidate.Cancel()
+				candidate.CloseConn()
+			}
+		})
+		It("must hand out a bigger token to every new leader", func() {
+			var previousToken int64
+			for i, candidate := range candidates {
+				Eventually(candidate.IsLeader, Timeout*2).Should(BeTrue())
+				token, ok := candidate.FencingToken()
+				Expect(ok).To(BeTrue())
+				Expect(token).To(BeNumerically(">", previousToken))
+				previousToken = token
+				for _, follower := range candidates[i+1:] {
+					_, ok = follower.FencingToken()
+					Expect(ok).To(BeFalse())
+				}
+				candidate.Cancel()
+				candidate.CloseConn()
+				Eventually(candidate.IsLeader, Timeout).Should(BeFalse())
+				_, ok = candidate.FencingToken()
+				Expect(ok).To(BeFalse())
+			}
+		})
+	})
+
+	Describe("Deleting the znode of a running leader", func() {
+		BeforeEach(func() {
+			leaderElection = defaultLeaderElection()
+			err = leaderElection.StartElectionLoopWithoutFailureReties()
+			if err != nil {
+				panic(err)
+			}
+			Eventually(leaderElection.IsLeader, Timeout).Should(BeTrue())
+		})
+		AfterEach(func() {
+			leaderElection.Cancel()
+		})
+		It("must drop the leadership and volunteer again with a new znode", func() {
+			children, _, err := conn.Children(Namespace)
+			Expect(err).To(BeNil())
+			Expect(len(children)).To(Equal(1))
+			firstToken, ok := leaderElection.FencingToken()
+			Expect(ok).To(BeTrue())
+			Expect(conn.Delete(Namespace+"/"+children[0], -1)).To(Succeed())
+			Eventually(func() []string {
+				newChildren, _, _ := conn.Children(Namespace)
+				return newChildren
+			}, Timeout).Should(And(HaveLen(1), Not(ContainElement(children[0]))))
+			Eventually(leaderElection.IsLeader, Timeout).Should(BeTrue())
+			secondToken, ok := leaderElection.FencingToken()
+			Expect(ok).To(BeTrue())
+			Expect(secondToken).To(BeNumerically(">", firstToken))
+		})
+	})
+
+	Describe("Emptying the namespace under running candidates", func() {
+		BeforeEach(func() {
+			candidateCount = 3
+			candidates = createCandidates(candidateCount)
+			for _, candidate := range candidates {
+				err = candidate.Candidate()
+				if err != nil {
+					panic(err)
+				}
+				err = candidate.ReelectLeader()
+				if err != nil {
+					panic(err)
+				}
+				go candidate.ProcessEvents()
+			}
+		})
+		AfterEach(func() {
+			for _, candidate := range candidates {
+				candidate.Cancel()
+				candidate.CloseConn()
+			}
+		})
+		It("must make every candidate volunteer again and elect a single leader", func() {
+			children, _, err := conn.Children(Namespace)
+			Expect(err).To(BeNil())
+			Expect(len(children)).To(Equal(candidateCount))
+			for _, child := range children {
+				Expect(conn.Delete(Namespace+"/"+child, -1)).To(Succeed())
+			}
+			Eventually(func() []string {
+				newChildren, _, _ := conn.Children(Namespace)
+				return newChildren
+			}, Timeout).Should(And(HaveLen(candidateCount), Not(ContainElement(BeElementOf(children)))))
+			Eventually(func() int {
+				leaders := 0
+				for _, candidate := range candidates {
+					if candidate.IsLeader() {
+						leaders += 1
+					}
+				}
+				return leaders
+			}, Timeout).Should(Equal(1))
+		})
+	})
+
+	Describe("Re-electing after the namespace has been emptied", func() {
+		BeforeEach(func() {
+			candidates = createCandidates(1)
+			leaderElection = candidates[0]
+			err = leaderElection.Candidate()
+			if err != nil {
+				panic(err)
+			}
+			children, _, err := conn.Children(Namespace)
+			if err != nil {
+				panic(err)
+			}
+			for _, child := range children {
+				conn.Delete(Namespace+"/"+child, -1)
+			}
+		})
+		AfterEach(func() {
+			for _, candidate := range candidates {
+				candidate.CloseConn()
+			}
+		})
+		It("must report the lost candidacy instead of panicking", func() {
+			Expect(leaderElection.ReelectLeader()).To(MatchError(election.ErrCandidacyLost))
+			Expect(leaderElection.IsLeader()).To(BeFalse())
+		})
+	})
+
+	Describe("Connection events under the different disconnect policies", func() {
+		var (
+			connectionEvents chan coordination.Event
+			processErr       chan error
+		)
+		startLeader := func(policy election.DisconnectPolicy, fenceTimeout time.Duration) {
+			candidates = createCandidates(1)
+			leaderElection = candidates[0]
+			leaderElection.DisconnectPolicy = policy
+			leaderElection.FenceTimeout = fenceTimeout
+			connectionEvents = make(chan coordination.Event, 1)
+			leaderElection.SetWatcher(connectionEvents)
+			err = leaderElection.Candidate()
+			if err != nil {
+				panic(err)
+			}
+			err = leaderElection.ReelectLeader()
+			if err != nil {
+				panic(err)
+			}
+			Expect(leaderElection.IsLeader()).To(BeTrue())
+			processErr = make(chan error, 1)
+			go func() {
+				processErr <- leaderElection.ProcessEvents()
+			}()
+		}
+		AfterEach(func() {
+			for _, candidate := range candidates {
+				candidate.Cancel()
+				candidate.CloseConn()
+			}
+		})
+		It("must step down and exit on disconnect with StepDownOnDisconnect", func() {
+			startLeader(election.StepDownOnDisconnect, 0)
+			connectionEvents <- coordination.Event{Type: coordination.EventSession, State: coordination.StateDisconnected}
+			Eventually(processErr, Timeout).Should(Receive(BeNil()))
+			Expect(leaderElection.State()).To(Equal(election.Disconnected))
+		})
+		It("must keep the leadership through a reconnect with KeepLeadershipOnDisconnect", func() {
+			startLeader(election.KeepLeadershipOnDisconnect, 0)
+			connectionEvents <- coordination.Event{Type: coordination.EventSession, State: coordination.StateDisconnected}
+			Consistently(leaderElection.IsLeader, Timeout/4).Should(BeTrue())
+			connectionEvents <- coordination.Event{Type: coordination.EventSession, State: coordination.StateHasSession}
+			Consistently(leaderElection.IsLeader, Timeout).Should(BeTrue())
+			Expect(processErr).NotTo(Receive())
+		})
+		It("must step down after the session timeout with KeepLeadershipOnDisconnect", func() {
+			startLeader(election.KeepLeadershipOnDisconnect, 0)
+			connectionEvents <- coordination.Event{Type: coordination.EventSession, State: coordination.StateDisconnected}
+			Eventually(leaderElection.State, Timeout*2).Should(Equal(election.Disconnected))
+		})
+		It("must fence itself before the session timeout and come back with FenceOnDisconnect", func() {
+			startLeader(election.FenceOnDisconnect, Timeout/4)
+			connectionEvents <- coordination.Event{Type: coordination.EventSession, State: coordination.StateDisconnected}
+			Expect(leaderElection.IsLeader()).To(BeTrue())
+			Eventually(leaderElection.State, Timeout/2).Should(Equal(election.Disconnected))
+			connectionEvents <- coordination.Event{Type: coordination.EventSession, State: coordination.StateHasSession}
+			Eventually(leaderElection.IsLeader, Timeout).Should(BeTrue())
+			Expect(processErr).NotTo(Receive())
+		})
+		It("must restart the candidacy when the session expires whatever the policy", func() {
+			startLeader(election.KeepLeadershipOnDisconnect, 0)
+			connectionEvents <- coordination.Event{Type: coordination.EventSession, State: coordination.StateDisconnected}
+			connectionEvents <- coordination.Event{Type: coordination.EventSession, State: coordination.StateExpired}
+			Eventually(processErr, Timeout).Should(Receive(MatchError(coordination.ErrSessionExpired)))
+			Expect(leaderElection.State()).To(Equal(election.Disconnected))
+		})
+	})
+
+	Describe("Resigning the leadership", func() {
+		BeforeEach(func() {
+			candidateCount = 2
+			candidates = []*election.LeaderElection{}
+			for i := 0; i < candidateCount; i++ {
+				candidate := defaultLeaderElection()
+				err = candidate.StartElectionLoopWithFailureRetries()
+				if err != nil {
+					panic(err)
+				}
+				candidates = append(candidates, candidate)
+				Eventually(candidate.State, Timeout).Should(BeElementOf(election.Leader, election.Follower))
+			}
+			Expect(candidates[0].IsLeader()).To(BeTrue())
+		})
+		AfterEach(func() {
+			for _, candidate := range candidates {
+				candidate.Cancel()
+			}
+		})
+		It("must hand over the leadership and rejoin at the back of the queue", func() {
+			children, _, err := conn.Children(Namespace)
+			Expect(err).To(BeNil())
+			Expect(len(children)).To(Equal(candidateCount))
+			ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+			defer cancel()
+			Expect(candidates[0].Resign(ctx, election.Rejoin)).To(Succeed())
+			Expect(candidates[0].State()).To(Equal(election.Follower))
+			Eventually(candidates[1].IsLeader, Timeout).Should(BeTrue())
+			newChildren, _, err := conn.Children(Namespace)
+			Expect(err).To(BeNil())
+			Expect(len(newChildren)).To(Equal(candidateCount))
+			// the leader owned the smallest znode, the follower's znode must be kept
+			sort.Strings(children)
+			Expect(newChildren).NotTo(ContainElement(children[0]))
+			Expect(newChildren).To(ContainElement(children[1]))
+		})
+		It("must hand over the leadership and leave the election", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+			defer cancel()
+			Expect(candidates[0].Resign(ctx, election.Leave)).To(Succeed())
+			Eventually(candidates[0].State, Timeout).Should(Equal(election.Stopped))
+			Eventually(candidates[0].Ctx.Done(), Timeout).Should(BeClosed())
+			Eventually(candidates[1].IsLeader, Timeout).Should(BeTrue())
+			children, _, err := conn.Children(Namespace)
+			Expect(err).To(BeNil())
+			Expect(len(children)).To(Equal(candidateCount - 1))
+			Expect(candidates[0].Resign(ctx, election.Rejoin)).To(MatchError(election.ErrNotRunning))
+		})
+	})
+
+	Describe("Publishing the candidate identity", func() {
+		BeforeEach(func() {
+			candidateCount = 3
+			candidates = createCandidates(candidateCount)
+			for i, candidate := range candidates {
+				candidate.AdvertisedAddress = fmt.Sprintf("10.0.0.%d:8080", i)
+				candidate.Version = "1.2.3"
+				err = candidate.Candidate()
+				if err != nil {
+					panic(err)
+				}
+				err = candidate.ReelectLeader()
+				if err != nil {
+					panic(err)
+				}
+				go candidate.ProcessEvents()
+			}
+		})
+		AfterEach(func() {
+			for _, candidate := range candidates {
+				candidate.Cancel()
+				candidate.CloseConn()
+			}
+		})
+		It("must list the candidates in order and return the leader", func() {
+			infos, err := candidates[2].Candidates()
+			Expect(err).To(BeNil())
+			Expect(len(infos)).To(Equal(candidateCount))
+			for i, info := range infos {
+				Expect(info.ID).To(Equal(candidates[i].ID))
+				Expect(info.Address).To(Equal(candidates[i].AdvertisedAddress))
+				Expect(info.Version).To(Equal("1.2.3"))
+				Expect(info.Hostname).NotTo(BeEmpty())
+				Expect(info.StartTime).NotTo(BeZero())
+				Expect(info.Znode).To(ContainSubstring("c_00"))
+			}
+			leader, err := candidates[1].GetLeader()
+			Expect(err).To(BeNil())
+			Expect(leader.ID).To(Equal(candidates[0].ID))
+			candidates[0].Cancel()
+			candidates[0].CloseConn()
+			Eventually(func() string {
+				leader, _ := candidates[2].GetLeader()
+				return leader.ID
+			}, Timeout*2).Should(Equal(candidates[1].ID))
+		})
+		It("must tolerate candidates without a payload", func() {
+			_, err := conn.Create(Namespace+"/c_", []byte{}, zk.FlagEphemeral+zk.FlagSequence, zk.WorldACL(zk.PermAll))
+			Expect(err).To(BeNil())
+			infos, err := candidates[0].Candidates()
+			Expect(err).To(BeNil())
+			Expect(len(infos)).To(Equal(candidateCount + 1))
+			Expect(infos[candidateCount].ID).To(BeEmpty())
+			Expect(infos[candidateCount].Znode).To(ContainSubstring("c_00"))
+		})
+	})
+
+	Describe("Observing the election", func() {
+		var observer *election.Observer
+		BeforeEach(func() {
+			candidateCount = 2
+			candidates = createCandidates(candidateCount)
+			for _, candidate := range candidates {
+				err = candidate.Candidate()
+				if err != nil {
+					panic(err)
+				}
+				err = candidate.ReelectLeader()
+				if err != nil {
+					panic(err)
+				}
+				go candidate.ProcessEvents()
+			}
+			observer = &election.Observer{
+				ZkNamespace: Namespace,
+				ZkTimeout:   Timeout,
+				Zookeepers:  Zookeepers,
+			}
+			err = observer.StartObserving()
+			if err != nil {
+				panic(err)
+			}
+		})
+		AfterEach(func() {
+			observer.Cancel()
+			for _, candidate := range candidates {
+				candidate.Cancel()
+				candidate.CloseConn()
+			}
+		})
+		It("must follow the leader without becoming a candidate", func() {
+			var leader election.CandidateInfo
+			Eventually(observer.Changes(), Timeout).Should(Receive(&leader))
+			Expect(leader.ID).To(Equal(candidates[0].ID))
+			current, ok := observer.Leader()
+			Expect(ok).To(BeTrue())
+			Expect(current.ID).To(Equal(candidates[0].ID))
+			children, _, err := conn.Children(Namespace)
+			Expect(err).To(BeNil())
+			Expect(len(children)).To(Equal(candidateCount))
+
+			candidates[0].Cancel()
+			candidates[0].CloseConn()
+			Eventually(observer.Changes(), Timeout*2).Should(Receive(&leader))
+			Expect(leader.ID).To(Equal(candidates[1].ID))
+
+			candidates[1].Cancel()
+			candidates[1].CloseConn()
+			Eventually(observer.Changes(), Timeout*2).Should(Receive(&leader))
+			Expect(leader).To(BeZero())
+			_, ok = observer.Leader()
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("Running the election with New and Run", func() {
+		var (
+			ctx     context.Context
+			cancel  context.CancelFunc
+			elected chan struct{}
+			runErr  chan error
+		)
+		BeforeEach(func() {
+			elected = make(chan struct{}, 1)
+			leaderElection, err = election.New(Zookeepers, Namespace,
+				election.WithTimeout(Timeout),
+				election.WithID("node-1"),
+				election.WithOnElected(func(context.Context) {
+					elected <- struct{}{}
+				}),
+			)
+			if err != nil {
+				panic(err)
+			}
+			ctx, cancel = context.WithCancel(context.Background())
+			runErr = make(chan error, 1)
+			go func() {
+				runErr <- leaderElection.Run(ctx)
+			}()
+		})
+		AfterEach(func() {
+			cancel()
+		})
+		It("must become the leader and return once the caller's context is done", func() {
+			Eventually(elected, Timeout).Should(Receive())
+			Expect(leaderElection.IsLeader()).To(BeTrue())
+			leader, err := leaderElection.GetLeader()
+			Expect(err).To(BeNil())
+			Expect(leader.ID).To(Equal("node-1"))
+			Consistently(runErr).ShouldNot(Receive())
+			cancel()
+			Eventually(runErr, Timeout).Should(Receive(BeNil()))
+			Expect(leaderElection.State()).To(Equal(election.Stopped))
+			Eventually(func() []string {
+				children, _, _ := conn.Children(Namespace)
+				return children
+			}, Timeout*2).Should(BeEmpty())
+		})
+	})
+
+	Describe("Creating the namespace", func() {
+		It("must report a missing namespace with a typed error", func() {
+			leaderElection, err := election.New(Zookeepers, "/missing-election-namespace", election.WithTimeout(Timeout))
+			Expect(err).To(BeNil())
+			err = leaderElection.Run(context.Background())
+			var namespaceErr *election.NamespaceNotFoundError
+			Expect(errors.As(err, &namespaceErr)).To(BeTrue())
+			Expect(namespaceErr.Namespace).To(Equal("/missing-election-namespace"))
+			Expect(leaderElection.State()).To(Equal(election.Stopped))
+		})
+		It("must create the missing namespace recursively with the given ACL", func() {
+			nestedNamespace := Namespace + "/nested/election"
+			acl := zk.WorldACL(zk.PermRead | zk.PermCreate | zk.PermDelete)
+			leaderElection, err := election.New(Zookeepers, nestedNamespace,
+				election.WithTimeout(Timeout),
+				election.WithCreateNamespace(election.PersistentNamespace),
+				election.WithNamespaceACL(acl...),
+			)
+			Expect(err).To(BeNil())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go leaderElection.Run(ctx)
+			Expect(leaderElection.WaitForLeadership(ctx)).To(Succeed())
+			for _, path := range []string{Namespace + "/nested", nestedNamespace} {
+				nodeACL, _, err := conn.GetACL(path)
+				Expect(err).To(BeNil())
+				Expect(nodeACL).To(Equal(acl))
+			}
+			children, _, err := conn.Children(nestedNamespace)
+			Expect(err).To(BeNil())
+			Expect(len(children)).To(Equal(1))
+		})
+		It("must create the missing namespace with container znodes", func() {
+			nestedNamespace := Namespace + "/container"
+			leaderElection, err := election.New(Zookeepers, nestedNamespace,
+				election.WithTimeout(Timeout),
+				election.WithCreateNamespace(election.ContainerNamespace),
+			)
+			Expect(err).To(BeNil())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go leaderElection.Run(ctx)
+			Expect(leaderElection.WaitForLeadership(ctx)).To(Succeed())
+			exists, _, err := conn.Exists(nestedNamespace)
+			Expect(err).To(BeNil())
+			Expect(exists).To(BeTrue())
+		})
+	})
+
+	Describe("Securing the election with digest authentication", func() {
+		var securedNamespace string
+		BeforeEach(func() {
+			securedNamespace = Namespace + "/secured"
+			credentials := election.DigestCredentials{User: "election", Password: "secret"}
+			leaderElection, err = election.New(Zookeepers, securedNamespace,
+				election.WithTimeout(Timeout),
+				election.WithCreateNamespace(election.PersistentNamespace),
+				election.WithDigestAuth(credentials.User, credentials.Password),
+				election.WithACLProvider(election.DigestACLProvider(credentials)),
+			)
+			if err != nil {
+				panic(err)
+			}
+		})
+		It("must only let the service principal change the election", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			runErr := make(chan error, 1)
+			go func() {
+				runErr <- leaderElection.Run(ctx)
+			}()
+			Expect(leaderElection.WaitForLeadership(ctx)).To(Succeed())
+			children, _, err := conn.Children(securedNamespace)
+			Expect(err).To(BeNil())
+			Expect(len(children)).To(Equal(1))
+			candidatePath := securedNamespace + "/" + children[0]
+			// the test connection is not authenticated
+			Expect(conn.Delete(candidatePath, -1)).To(MatchError(zk.ErrNoAuth))
+			_, err = conn.Set(candidatePath, []byte("stolen"), -1)
+			Expect(err).To(MatchError(zk.ErrNoAuth))
+			_, err = conn.Create(securedNamespace+"/c_", []byte{}, zk.FlagEphemeral+zk.FlagSequence, zk.WorldACL(zk.PermAll))
+			Expect(err).To(MatchError(zk.ErrNoAuth))
+			// everyone can still find the leader
+			_, _, err = conn.Get(candidatePath)
+			Expect(err).To(BeNil())
+			Expect(leaderElection.IsLeader()).To(BeTrue())
+			// stop the election so that the namespace can be cleaned up
+			cancel()
+			Eventually(runErr, Timeout).Should(Receive(BeNil()))
+			Eventually(func() []string {
+				children, _, _ := conn.Children(securedNamespace)
+				return children
+			}, Timeout*2).Should(BeEmpty())
+		})
+	})
+
+	Describe("Connecting through TLS", func() {
+		var (
+			proxyAddress string
+			tlsConfig    *utils.TLSConfig
+			stopProxy    func()
+		)
+		BeforeEach(func() {
+			proxyAddress, tlsConfig, stopProxy = startTLSProxy(GinkgoT().TempDir())
+		})
+		AfterEach(func() {
+			stopProxy()
+		})
+		It("must become the leader through the TLS proxy", func() {
+			leaderElection, err := election.New([]string{proxyAddress}, Namespace,
+				election.WithTimeout(Timeout),
+				election.WithTLS(tlsConfig),
+			)
+			Expect(err).To(BeNil())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go leaderElection.Run(ctx)
+			waitCtx, waitCancel := context.WithTimeout(ctx, Timeout*2)
+			defer waitCancel()
+			Expect(leaderElection.WaitForLeadership(waitCtx)).To(Succeed())
+			children, _, err := conn.Children(Namespace)
+			Expect(err).To(BeNil())
+			Expect(len(children)).To(Equal(1))
+		})
+		It("must not connect without a client certificate", func() {
+			leaderElection, err := election.New([]string{proxyAddress}, Namespace,
+				election.WithTimeout(Timeout),
+				election.WithTLS(&utils.TLSConfig{CAFile: tlsConfig.CAFile, ServerName: tlsConfig.ServerName}),
+			)
+			Expect(err).To(BeNil())
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go leaderElection.Run(ctx)
+			waitCtx, waitCancel := context.WithTimeout(ctx, Timeout)
+			defer waitCancel()
+			Expect(leaderElection.WaitForLeadership(waitCtx)).To(MatchError(context.DeadlineExceeded))
+		})
+		It("must fail with an unreadable CA bundle", func() {
+			_, err := election.New([]string{proxyAddress}, Namespace,
+				election.WithTimeout(Timeout),
+				election.WithTLS(&utils.TLSConfig{CAFile: "/does/not/exist.pem"}),
+			)
+			Expect(err).NotTo(BeNil())
 		})
 	})
 
@@ -188,7 +864,7 @@ var _ = Describe("Election", func() {
 			for _, child := range children {
 				Expect(child).To(ContainSubstring("c_00"))
 			}
-			Expect(candidates[0].IsLeader).To(BeTrue())
+			Expect(candidates[0].IsLeader()).To(BeTrue())
 		})
 	})
 
@@ -227,7 +903,7 @@ var _ = Describe("Election", func() {
 				Expect(child).To(ContainSubstring("c_00"))
 			}
 			for _, candidate := range candidates {
-				if candidate.IsLeader {
+				if candidate.IsLeader() {
 					leaders += 1
 				} else {
 					followers += 1
@@ -274,7 +950,7 @@ var _ = Describe("Election", func() {
 				Expect(child).To(ContainSubstring("c_00"))
 			}
 			for _, candidate := range candidates {
-				if candidate.IsLeader {
+				if candidate.IsLeader() {
 					leaders += 1
 				} else {
 					followers += 1
@@ -291,7 +967,7 @@ var _ = Describe("Election", func() {
 			leaders = 0
 			var newCandidates []*election.LeaderElection
 			for i, candidate := range candidates {
-				if candidate.IsLeader {
+				if candidate.IsLeader() {
 					candidate.Cancel()
 					newCandidates = append(candidates[:i], candidates[i+1:]...)
 					// we must close the connection to expire the session
@@ -310,7 +986,7 @@ var _ = Describe("Election", func() {
 			}
 
 			for _, candidate := range newCandidates {
-				if candidate.IsLeader {
+				if candidate.IsLeader() {
 					leaders += 1
 				} else {
 					followers += 1
@@ -357,7 +1033,7 @@ var _ = Describe("Election", func() {
 				Expect(child).To(ContainSubstring("c_00"))
 			}
 			for _, candidate := range candidates {
-				if candidate.IsLeader {
+				if candidate.IsLeader() {
 					leaders += 1
 				} else {
 					followers += 1
@@ -378,7 +1054,7 @@ var _ = Describe("Election", func() {
 				tmpCandidates := []*election.LeaderElection{}
 				newCandidateCount -= 1
 				for i, candidate := range newCandidates {
-					if candidate.IsLeader {
+					if candidate.IsLeader() {
 						candidate.Cancel()
 						tmpCandidates = append(newCandidates[:i], newCandidates[i+1:]...)
 						// we must close the connection to expire the session
@@ -401,7 +1077,7 @@ var _ = Describe("Election", func() {
 				}
 
 				for _, candidate := range newCandidates {
-					if candidate.IsLeader {
+					if candidate.IsLeader() {
 						leaders += 1
 					} else {
 						followers += 1
@@ -418,3 +1094,22 @@ var _ = Describe("Election", func() {
 		})
 	})
 })
+
+var _ = Describe("Configuring the election with New", func() {
+	It("must reject an invalid configuration", func() {
+		_, err := election.New(nil, Namespace)
+		Expect(err).NotTo(BeNil())
+		_, err = election.New(Zookeepers, "")
+		Expect(err).NotTo(BeNil())
+		_, err = election.New(Zookeepers, Namespace, election.WithTimeout(Timeout), election.WithDisconnectPolicy(election.FenceOnDisconnect), election.WithFenceTimeout(Timeout*2))
+		Expect(err).NotTo(BeNil())
+	})
+	It("must apply the defaults", func() {
+		leaderElection, err := election.New(Zookeepers, Namespace, election.WithDisconnectPolicy(election.FenceOnDisconnect))
+		Expect(err).To(BeNil())
+		Expect(leaderElection.ZkTimeout).To(Equal(election.DefaultZkTimeout))
+		Expect(leaderElection.FenceTimeout).To(Equal(election.DefaultZkTimeout / 2))
+		Expect(leaderElection.ID).NotTo(BeEmpty())
+		Expect(leaderElection.State()).To(Equal(election.Disconnected))
+	})
+})
@@ -0,0 +1,32 @@
+package election
+
+import (
+	"errors"
+	"fmt"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/leadership"
+)
+
+var (
+	// ErrElectionStopped is returned by WaitForLeadership when the election loop exits before the node becomes the leader
+	ErrElectionStopped = leadership.ErrStopped
+	// ErrCandidacyLost is returned when the znode of the current node is not among the candidates anymore
+	// this happens when the znode is deleted by someone else while the session is still valid
+	ErrCandidacyLost = errors.New("candidate znode no longer exists")
+	// ErrNotRunning is returned by Resign, GetLeader and Candidates when the election loop is not running
+	ErrNotRunning = errors.New("election is not running")
+	// ErrNoLeader is returned by GetLeader when there are no candidates in the namespace
+	ErrNoLeader = errors.New("no leader")
+	// ErrLeaseLost is returned by the LeaseLock implementations when the lock is not held by the caller anymore
+	ErrLeaseLost = errors.New("lease is not held anymore")
+)
+
+// NamespaceNotFoundError is returned when the namespace does not exist and CreateNamespace is not set
+type NamespaceNotFoundError struct {
+	// Namespace is the namespace that was not found
+	Namespace string
+}
+
+func (e *NamespaceNotFoundError) Error() string {
+	return fmt.Sprintf("namespace %s does not exist", e.Namespace)
+}
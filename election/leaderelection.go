@@ -2,46 +2,119 @@ package election
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	backoff "github.com/cenkalti/backoff/v4"
 	"github.com/go-zookeeper/zk"
 	"github.com/rs/zerolog"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
 )
 
 // LeaderElection is the struct that will be used to configure the leader election
 // It is exported so that the calling program can configure it
 // Only
 type LeaderElection struct {
-	// namespace is the namespace on zookeeper that will be used for the election. It must be created manually before the election can start
+	// namespace is the namespace on zookeeper that will be used for the election. It must be created manually before the election can start unless CreateNamespace is set
 	ZkNamespace string
+	// CreateNamespace creates the namespace and its parents if they do not exist
+	CreateNamespace bool
+	// NamespaceMode is the kind of znodes created for the namespace when CreateNamespace is set. The default value is PersistentNamespace
+	NamespaceMode NamespaceMode
+	// NamespaceACL is the ACL of the znodes created for the namespace. The default value is given by ACLProvider
+	NamespaceACL []zk.ACL
+	// DigestAuth are the credentials used to authenticate the connection with the digest scheme. They are submitted again on every reconnect
+	// If they are not provided, the connection is not authenticated
+	DigestAuth *DigestCredentials
+	// TLS is the configuration used to encrypt the connection to zookeeper. If it is not provided, the connection is plain TCP
+	TLS *utils.TLSConfig
+	// ACLProvider returns the ACL of the znodes created by the election
+	// The default value gives all permissions to everyone, use DigestACLProvider to restrict the writes to the service principal
+	ACLProvider ACLProvider
 	// ZkTimeout is the timeout for the zookeeper connection and the session for the ephemeral znodes
 	ZkTimeout time.Duration
-	// Zookeepers is a list of zookeeper servers that will be used for the election
+	// Zookeepers is a list of zookeeper servers that will be used for the election. It is not needed when Backend is set
 	Zookeepers []string
+	// Backend is the coordination store that will be used for the election
+	// The default value is a zookeeper backend built from Zookeepers, ZkTimeout, TLS, DigestAuth and the ACLs
+	Backend coordination.Backend
 	// Log is logger that will be used. It is zerolog, it is exported to allow for configuration
 	// if you don't provide a logger, it will use the default logger
 	Log *zerolog.Logger
-	// IsLeader is a boolean that indicates if the node is the leader or not. This should be evaluated regularly by the calling program to determine what to do
-	IsLeader bool
 	// Backoff is the backoff strategy that will be used to retry the election
 	// The default value is an exponential backoff with a max elapsed time of 0 so it will retry forever
 	// Only the default value is tested
 	Backoff backoff.BackOff
+	// DisconnectPolicy decides what happens to the leadership when the connection to zookeeper is lost
+	// The default value is StepDownOnDisconnect
+	DisconnectPolicy DisconnectPolicy
+	// FenceTimeout is how long after its last successful contact with the server a disconnected leader keeps the leadership with the FenceOnDisconnect policy
+	// It must be smaller than ZkTimeout. The default value is half of ZkTimeout
+	FenceTimeout time.Duration
 	// Cancel is the cancel function for the context that will be used to cancel the election loop. You can safely use it to cancel the loop
+	// It does not wait for the loop to exit, use Stop to also release the candidate znode and wait for the loop
 	Cancel context.CancelFunc
 	// Ctx is the context that will be used to cancel the election loop
 	Ctx context.Context
-	// conn is the zookeeper connection and is shared across the functions
-	conn *zk.Conn
+	// Callbacks are called when the leadership of the node flips, the functions of RunWhileLeader run along with them
+	Callbacks
+	// Leadership publishes the state of the node
+	Leadership
+	// ID is the unique identifier of the node that is published in the candidate znode
+	// The default value is generated by utils.GetUniqueIdentifier
+	ID string
+	// AdvertisedAddress is the address the node can be reached at, it is published in the candidate znode so that others can find the leader
+	AdvertisedAddress string
+	// Version is the version of the calling program, it is published in the candidate znode
+	Version string
+	// Priority is published in the candidate znode, the live candidate with the highest priority becomes the leader and ties are broken by sequence
+	// A candidate that is first in the queue lets the candidates with a higher priority go first. The default value is 0
+	Priority int
+	// Preempt makes the leader hand the leadership over as soon as a candidate with a higher priority joins
+	// Without it, the leader keeps the leadership and the priorities only decide who takes over when it goes away
+	Preempt bool
+	// startTime is the time at which the node was configured, it is published in the candidate znode
+	startTime time.Time
+	// connMu protects conn against the readers that do not run in the election goroutine
+	connMu sync.Mutex
+	// conn is the session with the coordination store and is shared across the functions
+	conn coordination.Session
 	// connectionWatcher is the channel that will be used to watch for connection events
-	connectionWatcher <-chan zk.Event
+	connectionWatcher <-chan coordination.Event
 	// currentZnodeName is the name of the znode that the current node is using
 	currentZnodeName string
+	// currentZnodeCzxid is the zxid that created the current znode, it is used as the fencing token
+	currentZnodeCzxid int64
 	// leaderWatcher is the channel that will be used to watch for predecessor node events
-	watchPredecessor <-chan zk.Event
+	watchPredecessor <-chan coordination.Event
+	// watchSelf is the channel that will be used to watch for events on the current node's znode
+	watchSelf <-chan coordination.Event
+	// watchCandidates is the channel that the leader uses to watch the candidates joining when Preempt is set
+	watchCandidates <-chan coordination.Event
+	// led tells if the current candidate znode has already won the election, it is reset when the node volunteers with a new znode
+	led bool
+	// priorities caches the priority of the other candidates by znode name, it is only used by the election goroutine
+	priorities map[string]int
+	// lastContact is the time in unix nanoseconds at which the last request answered by the server was sent, it is tracked while leader with FenceOnDisconnect
+	lastContact atomic.Int64
+	// resignRequests is the channel on which Resign hands its requests to the election goroutine
+	resignRequests chan resignRequest
+	// hooksMu protects hooks and is held by the election goroutine while the leadership changes
+	hooksMu sync.Mutex
+	// hooks are the functions registered by RunWhileLeader
+	hooks map[*leaderHook]struct{}
+	// stopMu protects Ctx, Cancel and resignRequests against the callers of Resign and Stop, as well as loopDone and stopRequested
+	stopMu sync.Mutex
+	// loopDone is closed once the election loop has exited, it is nil until the loop is started
+	loopDone chan struct{}
+	// stopRequested is set by Stop so that the loop deletes its znode before closing the connection
+	stopRequested bool
 }
 
 // preElection is a function that will be called before the election loop starts
@@ -59,26 +132,46 @@ func (l *LeaderElection) preElection() error {
 	// establish connection to zookeeper, if it fails, the function will return
 	// if the connection is lost at any point after a succesful connection, it will infinitely try to reconnect until the connection is closed
 	l.Log.Info().Msg("Connecting to zookeeper")
+	l.setState(Disconnected)
 	if l.conn != nil {
 		l.conn.Close()
 		l.connectionWatcher = nil
 	}
-	l.conn, l.connectionWatcher, err = zk.Connect(l.Zookeepers, l.ZkTimeout)
+	conn, err := l.backend().Connect()
 	if err != nil {
 		l.Log.Info().Err(err).Msg("Failed connecting to zookeeper")
 		return err
 	}
+	// the connection is also used by GetLeader and Candidates from other goroutines
+	l.connMu.Lock()
+	l.conn, l.connectionWatcher = conn, conn.Events()
+	l.connMu.Unlock()
 	// check namespace exists
-	l.Log.Info().Msg("Checking namespace exists")
-	exists, _, err := l.conn.Exists(l.ZkNamespace)
+	return l.ensureNamespace()
+}
+
+// Run runs the leader election until ctx is done or the node leaves the election through Resign
+// it blocks the calling goroutine, failures are retried with the backoff strategy and the leadership is reported through the state and the callbacks
+// it returns an error only when the configuration is invalid or the namespace does not exist, in which case the election is not started
+func (l *LeaderElection) Run(ctx context.Context) error {
+	l.defaultConfig()
+	err := l.validateConfig()
 	if err != nil {
-		l.Log.Info().Err(err).Msg("Failed to check if namespace exists")
 		return err
 	}
-	if !exists {
-		l.Log.Info().Msg("Namespace does not exist. You must create it")
+	l.startContext(ctx)
+	l.beginLoop()
+	// a missing namespace will not fix itself, report it instead of retrying forever
+	err = l.preElection()
+	var namespaceErr *NamespaceNotFoundError
+	if errors.As(err, &namespaceErr) {
+		l.exitLoop()
 		return err
 	}
+	if err != nil {
+		l.Log.Info().Err(err).Msg("Failed to preform pre-election tasks")
+	}
+	l.electionLoop(err == nil)
 	return nil
 }
 
@@ -88,16 +181,19 @@ func (l *LeaderElection) preElection() error {
 // It will continue to run normally and attempt
 // This is useful if you want to handle the failure yourself
 // If you want the election to retry, use StartElectionLoopWithFailureRetries
+//
+// Deprecated: use New and Run, which honor the caller's context
 func (l *LeaderElection) StartElectionLoopWithoutFailureReties() error {
+	l.startContext(context.Background())
 	err := l.preElection()
 	if err != nil {
 		return err
 	}
+	l.beginLoop()
 	// start the leader election routine
 	go func(l *LeaderElection) {
-		// defer closing the connection
-		defer l.conn.Close()
-		defer l.Cancel()
+		// revoke the leadership and close the connection when the loop exits
+		defer l.exitLoop()
 		// start the election
 		l.Log.Info().Msg("Volunteering for candidate")
 		err = l.candidate()
@@ -111,6 +207,10 @@ func (l *LeaderElection) StartElectionLoopWithoutFailureReties() error {
 			return
 		}
 		err = l.processEvents()
+		if errors.Is(err, errLeftElection) {
+			l.Log.Info().Msg("Left the election. Exiting")
+			return
+		}
 		if err != nil {
 			l.Log.Info().Err(err).Msg("Failed to process events")
 			return
@@ -121,85 +221,156 @@ func (l *LeaderElection) StartElectionLoopWithoutFailureReties() error {
 }
 
 // StartElectionLoop starts the leader election process based on the configuration provided in the struct
+//
+// Deprecated: use New and Run, which honor the caller's context
 func (l *LeaderElection) StartElectionLoopWithFailureRetries() error {
 	var err error
+	l.startContext(context.Background())
 	err = l.preElection()
 	if err != nil {
 		l.Log.Info().Err(err).Msg("Failed to preform pre-election tasks")
 		return err
 	}
-	firstRun := true
+	l.beginLoop()
 	// start the leader election routine
-	go func(l *LeaderElection) {
-		// defer closing the connection
-		defer l.conn.Close()
-		defer l.Cancel()
-		var nextBackOff time.Duration
-		var lastretryTime time.Time
-		// start the election loop
-		l.Log.Info().Msg("Starting leader election loop")
-		for {
-			// reset the backoff if we haven't failed in a while
-			if time.Since(lastretryTime) > 10*time.Minute {
-				l.Backoff.Reset()
-			}
-			// wait for the next retry using the randomized exponential backoff with jitter
-			nextBackOff = l.Backoff.NextBackOff()
-			lastretryTime = time.Now()
-			l.Log.Info().Msgf("Time for next attempt %s", nextBackOff)
-			select {
-			case <-l.Ctx.Done():
-				l.Log.Info().Msg("Context cancelled. Exiting")
-				l.IsLeader = false
-				return
-			case <-time.NewTicker(nextBackOff).C:
-				if !firstRun {
-					l.Log.Info().Msg("Retrying election")
-					err = l.preElection()
-					if err != nil {
-						l.Log.Log().Err(err).Msg("Failed to preform pre-election tasks")
-						continue
-					}
-				}
-				firstRun = false
-				l.Log.Info().Msg("Volunteering for candidate")
-				err = l.candidate()
-				if err != nil {
-					l.Log.Info().Err(err).Msg("Failed to volunteer for candidate")
-					continue
-				}
-				err = l.reelectLeader()
-				if err != nil {
-					l.Log.Info().Err(err).Msg("Failed to re-elect leader")
-					continue
-				}
-				err = l.processEvents()
+	go l.electionLoop(true)
+	return nil
+}
+
+// electionLoop runs the election with backoff retries until the context is done or the node leaves the election
+// connected tells if preElection already succeeded for the first attempt
+func (l *LeaderElection) electionLoop(connected bool) {
+	var err error
+	// revoke the leadership and close the connection when the loop exits
+	defer l.exitLoop()
+	var nextBackOff time.Duration
+	var lastretryTime time.Time
+	// start the election loop
+	l.Log.Info().Msg("Starting leader election loop")
+	for {
+		// reset the backoff if we haven't failed in a while
+		if time.Since(lastretryTime) > 10*time.Minute {
+			l.Backoff.Reset()
+		}
+		// wait for the next retry using the randomized exponential backoff with jitter
+		nextBackOff = l.Backoff.NextBackOff()
+		lastretryTime = time.Now()
+		l.Log.Info().Msgf("Time for next attempt %s", nextBackOff)
+		select {
+		case <-l.Ctx.Done():
+			l.Log.Info().Msg("Context cancelled. Exiting")
+			l.setState(Stopped)
+			return
+		case <-time.After(nextBackOff):
+			if !connected {
+				l.Log.Info().Msg("Retrying election")
+				err = l.preElection()
 				if err != nil {
-					l.Log.Info().Err(err).Msg("Failed to process events")
+					l.Log.Log().Err(err).Msg("Failed to preform pre-election tasks")
 					continue
 				}
 			}
+			connected = false
+			l.Log.Info().Msg("Volunteering for candidate")
+			err = l.candidate()
+			if err != nil {
+				l.Log.Info().Err(err).Msg("Failed to volunteer for candidate")
+				continue
+			}
+			err = l.reelectLeader()
+			if err != nil {
+				l.Log.Info().Err(err).Msg("Failed to re-elect leader")
+				continue
+			}
+			err = l.processEvents()
+			if errors.Is(err, errLeftElection) {
+				l.Log.Info().Msg("Left the election. Exiting")
+				return
+			}
+			if err != nil {
+				l.Log.Info().Err(err).Msg("Failed to process events")
+				continue
+			}
 		}
-	}(l)
-	return nil
+	}
+}
+
+// closeConn closes the current zookeeper connection if there is one
+func (l *LeaderElection) closeConn() {
+	l.connMu.Lock()
+	defer l.connMu.Unlock()
+	if l.conn != nil {
+		l.conn.Close()
+	}
 }
 
 // candidate is the function that will volunteer the current node as a candidate for leader by creating an ephemeral znode with a sequential suffix
+// the znode holds the json encoded CandidateInfo of the node
 func (l *LeaderElection) candidate() error {
 	l.Log.Info().Msg("Starting leader election")
 	znodePrefix := l.ZkNamespace + "/c_"
-	znodeFullPath, err := l.conn.Create(znodePrefix, []byte{}, zk.FlagEphemeral+zk.FlagSequence, zk.WorldACL(zk.PermAll))
+	data, err := json.Marshal(l.candidateInfo())
+	if err != nil {
+		l.Log.Info().Err(err).Msg("Failed to encode candidate info")
+		return err
+	}
+	znodeFullPath, err := l.conn.Create(znodePrefix, data, coordination.EphemeralSequential)
+	if err == coordination.ErrNoNode && l.CreateNamespace {
+		// container namespaces are removed by zookeeper once they are empty, create it again
+		err = l.createNamespace()
+		if err == nil {
+			znodeFullPath, err = l.conn.Create(znodePrefix, data, coordination.EphemeralSequential)
+		}
+	}
 	if err != nil {
 		l.Log.Info().Err(err).Msg("Failed to create znode")
 		return err
 	}
 	l.currentZnodeName = strings.Replace(znodeFullPath, l.ZkNamespace+"/", "", 1)
+	// watch our own znode so that we notice when it is deleted by someone else
+	// the czxid of the znode is used as the fencing token if this candidacy wins the election
+	exists, stat, err := l.watchCurrentZnode()
+	if err != nil {
+		l.Log.Info().Err(err).Msg("Failed to watch znode")
+		return err
+	}
+	if !exists {
+		l.Log.Info().Msg("Znode disappeared right after its creation")
+		return ErrCandidacyLost
+	}
+	l.currentZnodeCzxid = stat.CreateRevision
+	l.led = false
+	l.setState(Candidate)
 	return nil
 }
 
+// watchCurrentZnode sets the watchSelf channel to watch the znode of the current node
+func (l *LeaderElection) watchCurrentZnode() (bool, coordination.Stat, error) {
+	var exists bool
+	var stat coordination.Stat
+	var err error
+	l.watchSelf = nil
+	exists, stat, l.watchSelf, err = l.conn.ExistsW(l.ZkNamespace + "/" + l.currentZnodeName)
+	return exists, stat, err
+}
+
+// recoverCandidacy is called when the znode of the current node is gone while the session is still valid
+// the leadership is dropped immediately and the node volunteers again with a new znode
+func (l *LeaderElection) recoverCandidacy() error {
+	l.Log.Info().Msgf("Znode %s is gone, volunteering again", l.currentZnodeName)
+	l.setState(Candidate)
+	err := l.candidate()
+	if err != nil {
+		l.Log.Info().Err(err).Msg("Failed to volunteer for candidate")
+		return err
+	}
+	return l.reelectLeader()
+}
+
 // reelectLeader is the function that will re-elect the leader if the current node is not the leader
 // it will get the list of children and sort them, then check if the current node is the smallest
-// if it is, it will set the IsLeader flag to true, otherwise it will set it to false
+// if it is, it will move the node to the Leader state unless a candidate with a higher priority is waiting, in which case the node moves to the back of the queue
+// otherwise it will move it to the Follower state
 // it will also set the watchPredecessor channel to watch the predecessor node
 // if the predecessor node is deleted, it will trigger an event that will be processed in the processEvents function
 func (l *LeaderElection) reelectLeader() error {
@@ -209,30 +380,60 @@ func (l *LeaderElection) reelectLeader() error {
 	var err error
 	var exists bool
 	l.watchPredecessor = nil
+	l.watchCandidates = nil
 	for !exists {
-		children, _, err = l.conn.Children(l.ZkNamespace)
+		children, err = l.conn.Children(l.ZkNamespace)
 		if err != nil {
 			l.Log.Info().Err(err).Msg("Failed to get children")
-			l.IsLeader = false
+			l.setState(Disconnected)
 			return err
 		}
 		sort.Strings(children)
+		// our own znode must still be there, otherwise we are not a candidate anymore
+		// this also covers an emptied namespace
+		position := sort.SearchStrings(children, l.currentZnodeName)
+		if position == len(children) || children[position] != l.currentZnodeName {
+			l.Log.Info().Msg("Znode is not among the candidates anymore")
+			l.setState(Candidate)
+			return ErrCandidacyLost
+		}
 		//the smallest child should be the leader
 		smallestChild := children[0]
 		if smallestChild == l.currentZnodeName {
+			yield, err := l.yieldsLeadership(children)
+			if err != nil {
+				l.Log.Info().Err(err).Msg("Failed to compare priorities")
+				return err
+			}
+			if yield {
+				l.Log.Info().Msg("A candidate with a higher priority is waiting, moving to the back of the queue")
+				err = l.dropCandidacy()
+				if err == nil {
+					err = l.candidate()
+				}
+				if err != nil {
+					l.Log.Info().Err(err).Msg("Failed to move to the back of the queue")
+					return err
+				}
+				continue
+			}
+			if !l.led {
+				// the observers and GetLeader tell the leader apart from a first candidate that is about to yield with this mark
+				err = l.markElected()
+				if err != nil {
+					l.Log.Info().Err(err).Msg("Failed to publish the leadership")
+					return err
+				}
+				l.led = true
+			}
 			l.Log.Info().Msg("I am the leader")
-			l.IsLeader = true
+			l.setState(Leader)
 			return nil
 		} else {
 			l.Log.Info().Msg("I am not the leader")
-			l.IsLeader = false
-			for _, child := range children {
-				if child == l.currentZnodeName {
-					break
-				}
-				//get the child before the current node
-				predecessorName = child
-			}
+			l.setState(Follower)
+			//get the child before the current node
+			predecessorName = children[position-1]
 			l.Log.Info().Msgf("Predecessor is %s", predecessorName)
 			// we need to watch the predecessor node because when it is deleted, we need to re-elect the leader
 			exists, _, l.watchPredecessor, err = l.conn.ExistsW(l.ZkNamespace + "/" + predecessorName)
@@ -248,40 +449,143 @@ func (l *LeaderElection) reelectLeader() error {
 // processEvents is the function that will process events from the watchPredecessor channel and the connectionWatcher channel
 // if the event comes from the watchPredecessor channel, it will check if the predecessor has been deleted
 // if it has, it will re-elect the leader by calling the reelectLeader function
+// if the event comes from the watchSelf channel and the current node's znode has been deleted, it will drop the leadership and volunteer again
+// if a resign request is received, it will delete the current node's znode and either volunteer again or exit
 // if the event comes from the connectionWatcher channel, it will check if the connection has been lost
-// if it has, it will exit the processEvents function and the leader election will be restarted with backoff retries
+// if it has, what happens depends on the DisconnectPolicy. With StepDownOnDisconnect it will exit the processEvents function and the leader election will be restarted with backoff retries
+// with the other policies it will wait for the connection to come back and only exit if the session expired
 func (l *LeaderElection) processEvents() error {
 	l.Log.Info().Msg("Processing events")
+	// disconnected is true while the connection is lost but the session may still be alive
+	disconnected := false
+	// fenceTimer fires when a leader has been disconnected for too long to keep the leadership
+	fenceTimer := time.NewTimer(0)
+	stopTimer(fenceTimer)
+	defer fenceTimer.Stop()
 	for {
 		select {
 		case <-l.Ctx.Done():
-			l.IsLeader = false
+			l.setState(Stopped)
 			return nil
 		case event := <-l.watchPredecessor:
 			l.Log.Info().Msgf("Received event from predecessor %v", event)
-			if event.Type == zk.EventNodeDeleted {
+			if event.Type == coordination.EventNotWatching {
+				// the session is gone, the connection watcher tells what to do next
+				l.watchPredecessor = nil
+				continue
+			}
+			if event.Type == coordination.EventNodeDeleted {
 				l.Log.Info().Msg("Predecessor deleted")
-				err := l.reelectLeader()
+			}
+			// the watch is consumed by the event, re-electing sets it again
+			err := l.reelectLeader()
+			if errors.Is(err, ErrCandidacyLost) {
+				err = l.recoverCandidacy()
+			}
+			if err != nil {
+				l.Log.Info().Err(err).Msg("Failed to re-elect leader")
+				return err
+			}
+		case event := <-l.watchCandidates:
+			l.Log.Info().Msgf("Received event from candidates %v", event)
+			l.watchCandidates = nil
+			if event.Type == coordination.EventNotWatching {
+				// the session is gone, the connection watcher tells what to do next
+				continue
+			}
+			// the priorities are compared again, the watch is set again as long as the node stays the leader
+			err := l.reelectLeader()
+			if errors.Is(err, ErrCandidacyLost) {
+				err = l.recoverCandidacy()
+			}
+			if err != nil {
+				l.Log.Info().Err(err).Msg("Failed to re-elect leader")
+				return err
+			}
+		case request := <-l.resignRequests:
+			err := l.resign(request.mode)
+			request.done <- err
+			if err != nil {
+				l.Log.Info().Err(err).Msg("Failed to resign")
+				return err
+			}
+			if request.mode == Leave {
+				return errLeftElection
+			}
+		case event := <-l.watchSelf:
+			l.Log.Info().Msgf("Received event from current znode %v", event)
+			switch event.Type {
+			case coordination.EventNotWatching:
+				// the session is gone, the connection watcher tells what to do next
+				l.watchSelf = nil
+			case coordination.EventNodeDeleted:
+				err := l.recoverCandidacy()
 				if err != nil {
-					l.Log.Info().Err(err).Msg("Failed to re-elect leader")
+					l.Log.Info().Err(err).Msg("Failed to recover candidacy")
+					return err
+				}
+			default:
+				// the watch is consumed by the event, set it again
+				exists, _, err := l.watchCurrentZnode()
+				if err == nil && !exists {
+					err = l.recoverCandidacy()
+				}
+				if err != nil {
+					l.Log.Info().Err(err).Msg("Failed to watch znode")
 					return err
 				}
 			}
+		case <-fenceTimer.C:
+			l.Log.Info().Msg("Still disconnected, stepping down")
+			l.setState(Disconnected)
 		case event := <-l.connectionWatcher:
 			l.Log.Info().Msgf("Received event from connection watcher %v", event)
-			if event.State == zk.StateDisconnected {
-				l.Log.Info().Msg("Disconnected")
-				l.IsLeader = false
-				return nil
+			switch event.State {
+			case coordination.StateDisconnected:
+				if l.DisconnectPolicy == StepDownOnDisconnect {
+					l.Log.Info().Msg("Disconnected")
+					l.setState(Disconnected)
+					return nil
+				}
+				if disconnected {
+					continue
+				}
+				disconnected = true
+				// the session and our znode survive as long as we reconnect before the session timeout
+				if l.State() == Leader {
+					l.Log.Info().Msgf("Disconnected, keeping the leadership for at most %s", l.leadershipGracePeriod())
+					fenceTimer.Reset(l.leadershipGracePeriod())
+				} else {
+					l.Log.Info().Msg("Disconnected")
+					l.setState(Disconnected)
+				}
+			case coordination.StateHasSession:
+				if !disconnected {
+					continue
+				}
+				disconnected = false
+				stopTimer(fenceTimer)
+				l.recordContact(time.Now())
+				// watches may have fired while we were away, check where we stand
+				l.Log.Info().Msg("Reconnected within the session timeout")
+				err := l.reelectLeader()
+				if errors.Is(err, ErrCandidacyLost) {
+					err = l.recoverCandidacy()
+				}
+				if err != nil {
+					l.Log.Info().Err(err).Msg("Failed to re-elect leader")
+					return err
+				}
+			case coordination.StateAuthFailed:
+				l.Log.Info().Msg("Authentication failed")
+				l.setState(Disconnected)
+				return coordination.ErrAuthFailed
+			case coordination.StateExpired:
+				// our znode is gone with the session, the candidacy has to be restarted from scratch
+				l.Log.Info().Msg("Session expired")
+				l.setState(Disconnected)
+				return coordination.ErrSessionExpired
 			}
-			//TODO: if I manually delete the current node's znode, it will not trigger an event in the connectionWatcher channel
-			// but for some reason it will trigger an event in the watchPredecessor channel
-			// check if current node's znode has been delete event
-			// the following code does not yet fix the problem but we must find it
-			// if event.Type == zk.EventNodeDeleted && event.Path == l.ZkNamespace+"/"+l.currentZnodeName {
-			// 	l.Log.Info().Msg("Current node's znode deleted")
-			// 	return nil
-			// }
 		}
 	}
 }
@@ -0,0 +1,66 @@
+package election
+
+import (
+	"context"
+	"time"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/leadership"
+)
+
+// State is the state of the node in the election
+type State = leadership.State
+
+const (
+	// Disconnected means the node has no usable session with zookeeper, cannot reach the lease lock or cannot reach its peers. This is also the state of an election that has not started yet
+	Disconnected = leadership.Disconnected
+	// Candidate means the node has volunteered by creating its znode but the leader has not been determined yet
+	Candidate = leadership.Candidate
+	// Follower means the node is a candidate and is waiting for its predecessor, or the holder of the lease lock, to go away
+	Follower = leadership.Follower
+	// Leader means the node is the leader
+	Leader = leadership.Leader
+	// Stopped means the election loop has exited and the node will not become leader again
+	Stopped = leadership.Stopped
+)
+
+// Leadership publishes the state of a node through State, IsLeader, FencingToken and WaitForLeadership
+// it is embedded by every election of this module so that they all expose the same API
+// only the elections can change the state, its zero value is a Disconnected node
+type Leadership = leadership.Leadership
+
+// Callbacks are the functions an election calls when the leadership of the node flips
+// LeaderElection takes them from WithOnElected and WithOnRevoked
+type Callbacks = leadership.Callbacks
+
+// Loop holds the logger, the callbacks, the context of the election loop and the published state of a node
+// it is embedded by LeaseElection and by the elections of the bully, ring and raft packages
+type Loop = leadership.Loop
+
+// FencingTokenFromContext returns the fencing token of the leadership term the context was created for
+// it only works with the context handed to OnElected
+func FencingTokenFromContext(ctx context.Context) (int64, bool) {
+	return leadership.FencingTokenFromContext(ctx)
+}
+
+// setState moves the node to the given state and fires the leadership callbacks when the leadership actually flips
+// the functions of RunWhileLeader are started with the leadership and waited for when it is lost, before the election goes on
+// it must only be called from the election goroutine
+func (l *LeaderElection) setState(state State) {
+	l.hooksMu.Lock()
+	defer l.hooksMu.Unlock()
+	previous := l.State()
+	leadership.Transition(&l.Leadership, state, l.currentZnodeCzxid, l.Ctx, l.Log, l.OnElected, func() {
+		l.waitHooksLocked()
+		if l.OnRevoked != nil {
+			l.OnRevoked()
+		}
+	})
+	if state == Leader && previous != Leader {
+		if l.DisconnectPolicy == FenceOnDisconnect {
+			// the election just read the candidates, which counts as a contact
+			l.recordContact(time.Now())
+			go l.probeContact(leadership.LeaderContext(&l.Leadership), l.conn, l.ZkNamespace+"/"+l.currentZnodeName)
+		}
+		l.startHooksLocked()
+	}
+}
@@ -0,0 +1,187 @@
+package election
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/leadership"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
+)
+
+const (
+	// DefaultLeaseDuration is the lease duration used by LeaseElection when LeaseDuration is not set
+	DefaultLeaseDuration = 15 * time.Second
+	// DefaultRenewDeadline is the renew deadline used by LeaseElection when RenewDeadline is not set
+	DefaultRenewDeadline = 10 * time.Second
+	// DefaultRetryPeriod is the retry period used by LeaseElection when RetryPeriod is not set
+	DefaultRetryPeriod = 2 * time.Second
+)
+
+// LeaseLock is a lock with a time to live that is held by at most one node at a time
+// the holder must renew it before it expires, otherwise anyone can take it over
+type LeaseLock interface {
+	// TryAcquire takes the lock for the holder if it is free, expired or already held by the holder, and returns the fencing token of the new leadership term
+	// every successful call starts a new term with a bigger token. ok is false if the lock is held by someone else
+	TryAcquire(ctx context.Context, holder string, duration time.Duration) (token int64, ok bool, err error)
+	// Renew extends the lock for another duration. It returns ErrLeaseLost if the holder does not hold the lock with the given token anymore
+	Renew(ctx context.Context, holder string, token int64, duration time.Duration) error
+	// Release frees the lock so that the next node does not have to wait for it to expire
+	// it returns ErrLeaseLost if the holder does not hold the lock with the given token anymore
+	Release(ctx context.Context, holder string, token int64) error
+}
+
+// LeaseElection elects a leader with a LeaseLock: the node that holds the lock is the leader
+// It publishes the same states and runs the same callbacks as LeaderElection
+type LeaseElection struct {
+	// Lock is the lock the nodes compete for
+	Lock LeaseLock
+	// ID is the unique identifier of the node, it is recorded as the holder of the lock
+	// The default value is generated by utils.GetUniqueIdentifier
+	ID string
+	// LeaseDuration is how long the other nodes wait after the last renewal before taking the lock over
+	// The default value is DefaultLeaseDuration
+	LeaseDuration time.Duration
+	// RenewDeadline is how long the leader keeps retrying to renew the lock before stepping down
+	// RenewDeadline plus RetryPeriod must be smaller than LeaseDuration so that the leader steps down before another node can take over. The default value is DefaultRenewDeadline
+	RenewDeadline time.Duration
+	// RetryPeriod is the time between two attempts to acquire or renew the lock
+	// It must be smaller than RenewDeadline. The default value is DefaultRetryPeriod
+	RetryPeriod time.Duration
+	// Loop holds the logger, the callbacks, the context of the election loop and the published state
+	Loop
+	// token is the fencing token of the lock held by the node
+	token int64
+}
+
+// defaultConfig initializes the recommended default values for the lease election
+func (l *LeaseElection) defaultConfig() {
+	if l.LeaseDuration == 0 {
+		l.LeaseDuration = DefaultLeaseDuration
+	}
+	if l.RenewDeadline == 0 {
+		l.RenewDeadline = DefaultRenewDeadline
+	}
+	if l.RetryPeriod == 0 {
+		l.RetryPeriod = DefaultRetryPeriod
+	}
+	if l.Log == nil {
+		l.Log = &log.Logger
+	}
+	if l.ID == "" {
+		id, err := utils.GetUniqueIdentifier()
+		if err != nil {
+			l.Log.Info().Err(err).Msg("Failed to get hostname for the identifier")
+			id = utils.RandomString(10)
+		}
+		l.ID = id
+	}
+}
+
+func (l *LeaseElection) validateConfig() error {
+	if l.Lock == nil {
+		return fmt.Errorf("no lease lock provided")
+	}
+	if l.RetryPeriod <= 0 || l.RenewDeadline <= l.RetryPeriod || l.LeaseDuration <= l.RenewDeadline+l.RetryPeriod {
+		return fmt.Errorf("lease durations must verify 0 < retry period < renew deadline and renew deadline + retry period < lease duration")
+	}
+	return nil
+}
+
+// Run competes for the lock until ctx is done, renewing it for as long as the node is the leader
+// it blocks the calling goroutine and releases the lock before returning
+// it returns an error only when the configuration is invalid, in which case the election is not started
+func (l *LeaseElection) Run(ctx context.Context) error {
+	l.defaultConfig()
+	err := l.validateConfig()
+	if err != nil {
+		return err
+	}
+	defer leadership.Start(&l.Loop, ctx)()
+	leadership.SetState(&l.Loop, Candidate)
+	for {
+		sent, ok := l.acquire()
+		if ok {
+			l.lead(sent)
+		}
+		select {
+		case <-l.Ctx.Done():
+			l.Log.Info().Msg("Context cancelled. Exiting")
+			return nil
+		case <-time.After(l.RetryPeriod):
+		}
+	}
+}
+
+// acquire tries to take the lock once and tells if the node is now the leader
+// sent is the time the request was sent, the lock cannot expire before LeaseDuration after it
+func (l *LeaseElection) acquire() (sent time.Time, ok bool) {
+	ctx, cancel := context.WithTimeout(l.Ctx, l.RetryPeriod)
+	defer cancel()
+	sent = time.Now()
+	token, ok, err := l.Lock.TryAcquire(ctx, l.ID, l.LeaseDuration)
+	if err != nil {
+		l.Log.Info().Err(err).Msg("Failed to acquire the lease")
+		leadership.SetState(&l.Loop, Disconnected)
+		return sent, false
+	}
+	if !ok {
+		leadership.SetState(&l.Loop, Follower)
+		return sent, false
+	}
+	l.token = token
+	leadership.Lead(&l.Loop, l.token)
+	return sent, true
+}
+
+// lead renews the lock every RetryPeriod until it is lost, cannot be renewed within RenewDeadline or the election is cancelled
+// lastRenewal is the time the request that took or last renewed the lock was sent, the renew deadline is timed from it
+// the leadership is always dropped before the lock is released so that the old and the new leader never overlap
+func (l *LeaseElection) lead(lastRenewal time.Time) {
+	ticker := time.NewTicker(l.RetryPeriod)
+	defer ticker.Stop()
+	// the deadline is checked on its own timer so that the leader does not wait for the next retry to step down
+	deadline := time.NewTimer(time.Until(lastRenewal.Add(l.RenewDeadline)))
+	defer deadline.Stop()
+	for {
+		select {
+		case <-l.Ctx.Done():
+			leadership.SetState(&l.Loop, Stopped)
+			l.release()
+			return
+		case <-deadline.C:
+			l.Log.Info().Msg("Renew deadline exceeded, stepping down")
+			leadership.SetState(&l.Loop, Disconnected)
+			return
+		case <-ticker.C:
+			sent := time.Now()
+			ctx, cancel := context.WithDeadline(l.Ctx, lastRenewal.Add(l.RenewDeadline))
+			err := l.Lock.Renew(ctx, l.ID, l.token, l.LeaseDuration)
+			cancel()
+			if err == nil {
+				lastRenewal = sent
+				stopTimer(deadline)
+				deadline.Reset(time.Until(lastRenewal.Add(l.RenewDeadline)))
+				continue
+			}
+			if errors.Is(err, ErrLeaseLost) {
+				l.Log.Info().Msg("Lease lost, stepping down")
+				leadership.SetState(&l.Loop, Follower)
+				return
+			}
+			l.Log.Info().Err(err).Msg("Failed to renew the lease")
+		}
+	}
+}
+
+// release frees the lock once the election is cancelled
+func (l *LeaseElection) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), l.RenewDeadline)
+	defer cancel()
+	err := l.Lock.Release(ctx, l.ID, l.token)
+	if err != nil {
+		l.Log.Info().Err(err).Msg("Failed to release the lease")
+	}
+}
@@ -0,0 +1,107 @@
+package election_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+)
+
+// slowLock is an in-memory LeaseLock whose renewals take renewDelay and fail while failing is set
+type slowLock struct {
+	mu         sync.Mutex
+	renewDelay time.Duration
+	failing    bool
+	// lastRenewal is the time the last successful renewal was sent
+	lastRenewal time.Time
+}
+
+func (s *slowLock) TryAcquire(ctx context.Context, holder string, duration time.Duration) (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return 0, false, errors.New("lock unavailable")
+	}
+	s.lastRenewal = time.Now()
+	return 1, true, nil
+}
+
+func (s *slowLock) Renew(ctx context.Context, holder string, token int64, duration time.Duration) error {
+	sent := time.Now()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(s.renewDelay):
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return errors.New("lock unavailable")
+	}
+	s.lastRenewal = sent
+	return nil
+}
+
+func (s *slowLock) Release(ctx context.Context, holder string, token int64) error {
+	return nil
+}
+
+// fail makes the next requests fail and returns the time the last successful renewal was sent
+func (s *slowLock) fail() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = true
+	return s.lastRenewal
+}
+
+var _ = Describe("Lease election on an in-memory lock", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("must refuse a renew deadline that leaves no room for a last retry within the lease duration", func() {
+		candidate := &election.LeaseElection{
+			Lock:          &slowLock{},
+			LeaseDuration: time.Second,
+			RenewDeadline: 800 * time.Millisecond,
+			RetryPeriod:   200 * time.Millisecond,
+		}
+		Expect(candidate.Run(ctx)).To(MatchError(ContainSubstring("lease duration")))
+	})
+
+	It("must step down at the renew deadline timed from when the last renewal was sent", func() {
+		lock := &slowLock{renewDelay: 100 * time.Millisecond}
+		revoked := make(chan time.Time, 1)
+		candidate := &election.LeaseElection{
+			Lock:          lock,
+			LeaseDuration: 2 * time.Second,
+			RenewDeadline: 500 * time.Millisecond,
+			RetryPeriod:   300 * time.Millisecond,
+		}
+		candidate.OnRevoked = func() {
+			revoked <- time.Now()
+		}
+		go candidate.Run(ctx)
+		Eventually(candidate.IsLeader).Should(BeTrue())
+		// let a few renewals go through before the lock becomes unreachable
+		time.Sleep(time.Second)
+		lastRenewal := lock.fail()
+		var steppedDown time.Time
+		Eventually(revoked, 2*time.Second).Should(Receive(&steppedDown))
+		// the deadline falls between two retries and the renewals take a while, neither may delay the step down
+		Expect(steppedDown.Sub(lastRenewal)).To(BeNumerically("~", 500*time.Millisecond, 50*time.Millisecond))
+		Expect(candidate.State()).To(Equal(election.Disconnected))
+	})
+})
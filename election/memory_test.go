@@ -0,0 +1,727 @@
+package election_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/memory"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
+)
+
+var _ = Describe("Election on the in-memory backend", func() {
+	var (
+		store      *memory.Store
+		admin      coordination.Session
+		ctx        context.Context
+		cancel     context.CancelFunc
+		candidates []*election.LeaderElection
+		err        error
+	)
+
+	// start runs count candidates one after the other so that they queue in order
+	start := func(count int, opts ...election.Option) {
+		for i := 0; i < count; i++ {
+			candidate, err := election.New(nil, Namespace, append([]election.Option{
+				election.WithBackend(store),
+				election.WithBackoff(backoff.NewConstantBackOff(10 * time.Millisecond)),
+				election.WithID(fmt.Sprintf("candidate-%d", len(candidates))),
+			}, opts...)...)
+			Expect(err).To(BeNil())
+			candidates = append(candidates, candidate)
+			go candidate.Run(ctx)
+			Eventually(candidate.State).Should(BeElementOf(election.Leader, election.Follower))
+		}
+	}
+	// session returns the in-memory session of the candidate
+	session := func(candidate *election.LeaderElection) *memory.Session {
+		return candidate.Session().(*memory.Session)
+	}
+	// queue returns the identifiers of the candidates in the order in which they will become leader
+	queue := func() []string {
+		infos, err := election.ListCandidates(admin, Namespace)
+		Expect(err).To(BeNil())
+		ids := []string{}
+		for _, info := range infos {
+			ids = append(ids, info.ID)
+		}
+		return ids
+	}
+
+	BeforeEach(func() {
+		candidates = nil
+		store = memory.New()
+		admin, err = store.Connect()
+		Expect(err).To(BeNil())
+		_, err = admin.Create(Namespace, []byte{}, coordination.Persistent)
+		Expect(err).To(BeNil())
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+	AfterEach(func() {
+		cancel()
+		for _, candidate := range candidates {
+			Eventually(candidate.State).Should(Equal(election.Stopped))
+		}
+		admin.Close()
+	})
+
+	It("must elect the first candidate and queue the others behind it", func() {
+		start(3)
+		Expect(candidates[0].IsLeader()).To(BeTrue())
+		Expect(candidates[1].State()).To(Equal(election.Follower))
+		Expect(candidates[2].State()).To(Equal(election.Follower))
+		Expect(queue()).To(Equal([]string{"candidate-0", "candidate-1", "candidate-2"}))
+	})
+
+	It("must fail over to the next candidate with a greater fencing token when the leader leaves", func() {
+		start(3)
+		firstToken, ok := candidates[0].FencingToken()
+		Expect(ok).To(BeTrue())
+		Expect(candidates[0].Resign(ctx, election.Leave)).To(Succeed())
+		Eventually(candidates[1].IsLeader).Should(BeTrue())
+		Expect(candidates[2].State()).To(Equal(election.Follower))
+		Eventually(candidates[0].State).Should(Equal(election.Stopped))
+		secondToken, ok := candidates[1].FencingToken()
+		Expect(ok).To(BeTrue())
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+	})
+
+	It("must only move the follower whose znode was deleted to the back of the queue", func() {
+		start(3)
+		children, err := admin.Children(Namespace)
+		Expect(err).To(BeNil())
+		Expect(admin.Delete(Namespace + "/" + children[1])).To(Succeed())
+		Eventually(queue).Should(Equal([]string{"candidate-0", "candidate-2", "candidate-1"}))
+		Eventually(candidates[1].State).Should(Equal(election.Follower))
+		Expect(candidates[0].IsLeader()).To(BeTrue())
+		Expect(candidates[2].State()).To(Equal(election.Follower))
+	})
+
+	It("must hand over the leadership when the session of the leader expires", func() {
+		start(3)
+		session(candidates[0]).Expire()
+		Eventually(candidates[1].IsLeader).Should(BeTrue())
+		Eventually(queue).Should(Equal([]string{"candidate-1", "candidate-2", "candidate-0"}))
+		Eventually(candidates[0].State).Should(Equal(election.Follower))
+	})
+
+	It("must step down and rejoin on disconnect with StepDownOnDisconnect", func() {
+		start(2)
+		session(candidates[0]).Disconnect()
+		Eventually(candidates[1].IsLeader).Should(BeTrue())
+		Eventually(candidates[0].State).Should(Equal(election.Follower))
+		Expect(queue()).To(Equal([]string{"candidate-1", "candidate-0"}))
+	})
+
+	It("must keep the leadership through a short disconnect with KeepLeadershipOnDisconnect", func() {
+		start(2, election.WithDisconnectPolicy(election.KeepLeadershipOnDisconnect))
+		leaderSession := session(candidates[0])
+		leaderSession.Disconnect()
+		Consistently(candidates[0].IsLeader, 100*time.Millisecond).Should(BeTrue())
+		leaderSession.Reconnect()
+		Consistently(candidates[0].IsLeader, 100*time.Millisecond).Should(BeTrue())
+		Expect(candidates[1].State()).To(Equal(election.Follower))
+	})
+
+	It("must fence a disconnected leader and restore it on reconnect with FenceOnDisconnect", func() {
+		start(2, election.WithTimeout(time.Second), election.WithDisconnectPolicy(election.FenceOnDisconnect), election.WithFenceTimeout(100*time.Millisecond))
+		leaderSession := session(candidates[0])
+		leaderSession.Disconnect()
+		Expect(candidates[0].IsLeader()).To(BeTrue())
+		Eventually(candidates[0].State).Should(Equal(election.Disconnected))
+		Expect(candidates[1].State()).To(Equal(election.Follower))
+		leaderSession.Reconnect()
+		Eventually(candidates[0].IsLeader).Should(BeTrue())
+	})
+
+	It("must time the fence from the last contact with the server rather than from the reported disconnect", func() {
+		start(2, election.WithTimeout(3*time.Second), election.WithDisconnectPolicy(election.FenceOnDisconnect), election.WithFenceTimeout(600*time.Millisecond))
+		leaderSession := session(candidates[0])
+		// the server stops answering but the client only notices later, like go-zookeeper after two thirds of the session timeout
+		stalled := time.Now()
+		leaderSession.Stall()
+		time.Sleep(500 * time.Millisecond)
+		Expect(candidates[0].IsLeader()).To(BeTrue())
+		leaderSession.Disconnect()
+		Eventually(candidates[0].IsLeader).Should(BeFalse())
+		Expect(time.Since(stalled)).To(BeNumerically("<", 800*time.Millisecond))
+		leaderSession.Reconnect()
+		Eventually(candidates[0].IsLeader).Should(BeTrue())
+	})
+
+	It("must call OnElected when elected and cancel its context before calling OnRevoked", func() {
+		elected := make(chan context.Context, 1)
+		revoked := make(chan error, 1)
+		var leaderCtx context.Context
+		start(1,
+			election.WithOnElected(func(ctx context.Context) {
+				elected <- ctx
+			}),
+			election.WithOnRevoked(func() {
+				revoked <- leaderCtx.Err()
+			}),
+		)
+		Eventually(elected).Should(Receive(&leaderCtx))
+		Expect(leaderCtx.Err()).To(BeNil())
+		token, ok := election.FencingTokenFromContext(leaderCtx)
+		Expect(ok).To(BeTrue())
+		currentToken, ok := candidates[0].FencingToken()
+		Expect(ok).To(BeTrue())
+		Expect(currentToken).To(Equal(token))
+		Consistently(revoked, 100*time.Millisecond).ShouldNot(Receive())
+		candidates[0].Cancel()
+		Eventually(revoked).Should(Receive(Equal(context.Canceled)))
+	})
+
+	It("must unblock the followers waiting for the leadership and report Stopped once cancelled", func() {
+		start(2)
+		Expect(candidates[0].WaitForLeadership(ctx)).To(Succeed())
+		waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer waitCancel()
+		Expect(candidates[1].WaitForLeadership(waitCtx)).To(MatchError(context.DeadlineExceeded))
+		candidates[0].Cancel()
+		Eventually(candidates[0].State).Should(Equal(election.Stopped))
+		Expect(candidates[0].IsLeader()).To(BeFalse())
+		Expect(candidates[0].WaitForLeadership(ctx)).To(MatchError(election.ErrElectionStopped))
+		Expect(candidates[1].WaitForLeadership(ctx)).To(Succeed())
+	})
+
+	It("must elect a single leader with a bigger token every time the leader goes away", func() {
+		start(5)
+		var previousToken int64
+		for i, candidate := range candidates {
+			Eventually(candidate.IsLeader).Should(BeTrue())
+			token, ok := candidate.FencingToken()
+			Expect(ok).To(BeTrue())
+			Expect(token).To(BeNumerically(">", previousToken))
+			previousToken = token
+			for _, follower := range candidates[i+1:] {
+				Expect(follower.State()).To(Equal(election.Follower))
+				_, ok = follower.FencingToken()
+				Expect(ok).To(BeFalse())
+			}
+			// the loop exits and closes the session as if the process had crashed
+			candidate.Cancel()
+			Eventually(candidate.State).Should(Equal(election.Stopped))
+			_, ok = candidate.FencingToken()
+			Expect(ok).To(BeFalse())
+			Expect(queue()).To(HaveLen(len(candidates) - i - 1))
+		}
+	})
+
+	It("must drop the leadership and volunteer again with a new znode when the znode of the leader is deleted", func() {
+		start(1)
+		children, err := admin.Children(Namespace)
+		Expect(err).To(BeNil())
+		firstToken, ok := candidates[0].FencingToken()
+		Expect(ok).To(BeTrue())
+		Expect(admin.Delete(Namespace + "/" + children[0])).To(Succeed())
+		Eventually(func() []string {
+			newChildren, _ := admin.Children(Namespace)
+			return newChildren
+		}).Should(And(HaveLen(1), Not(ContainElement(children[0]))))
+		Eventually(candidates[0].IsLeader).Should(BeTrue())
+		secondToken, ok := candidates[0].FencingToken()
+		Expect(ok).To(BeTrue())
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+	})
+
+	It("must make every candidate volunteer again and elect a single leader when the namespace is emptied", func() {
+		start(3)
+		children, err := admin.Children(Namespace)
+		Expect(err).To(BeNil())
+		for _, child := range children {
+			Expect(admin.Delete(Namespace + "/" + child)).To(Succeed())
+		}
+		Eventually(func() []string {
+			newChildren, _ := admin.Children(Namespace)
+			return newChildren
+		}).Should(And(HaveLen(3), Not(ContainElement(BeElementOf(children)))))
+		Eventually(func() int {
+			leaders := 0
+			for _, candidate := range candidates {
+				if candidate.IsLeader() {
+					leaders += 1
+				}
+			}
+			return leaders
+		}).Should(Equal(1))
+	})
+
+	It("must report the lost candidacy when the namespace is emptied before the election", func() {
+		candidate := &election.LeaderElection{ZkNamespace: Namespace, ZkTimeout: Timeout, Backend: store}
+		candidate.DefaultConfig()
+		defer candidate.Cancel()
+		candidateSession, err := store.Connect()
+		Expect(err).To(BeNil())
+		defer candidateSession.Close()
+		candidate.SetSession(candidateSession)
+		Expect(candidate.Candidate()).To(Succeed())
+		children, err := admin.Children(Namespace)
+		Expect(err).To(BeNil())
+		for _, child := range children {
+			Expect(admin.Delete(Namespace + "/" + child)).To(Succeed())
+		}
+		Expect(candidate.ReelectLeader()).To(MatchError(election.ErrCandidacyLost))
+		Expect(candidate.IsLeader()).To(BeFalse())
+	})
+
+	It("must step down once the session timeout is over with KeepLeadershipOnDisconnect", func() {
+		start(2, election.WithTimeout(500*time.Millisecond), election.WithDisconnectPolicy(election.KeepLeadershipOnDisconnect))
+		leaderSession := session(candidates[0])
+		leaderSession.Disconnect()
+		Consistently(candidates[0].IsLeader, 300*time.Millisecond).Should(BeTrue())
+		Eventually(candidates[0].State).Should(Equal(election.Disconnected))
+	})
+
+	It("must restart the candidacy when the session expires whatever the policy", func() {
+		for _, policy := range []election.DisconnectPolicy{election.KeepLeadershipOnDisconnect, election.FenceOnDisconnect} {
+			start(1, election.WithTimeout(time.Second), election.WithDisconnectPolicy(policy), election.WithFenceTimeout(100*time.Millisecond))
+		}
+		for _, candidate := range candidates {
+			Eventually(candidate.IsLeader).Should(BeTrue())
+			session(candidate).Disconnect()
+			session(candidate).Expire()
+			Eventually(candidate.State).Should(Equal(election.Follower))
+		}
+		Eventually(candidates[0].IsLeader).Should(BeTrue())
+		Expect(queue()).To(Equal([]string{"candidate-0", "candidate-1"}))
+	})
+
+	It("must hand over the leadership and rejoin at the back of the queue", func() {
+		start(2)
+		Expect(candidates[0].Resign(ctx, election.Rejoin)).To(Succeed())
+		Expect(candidates[0].State()).To(Equal(election.Follower))
+		Eventually(candidates[1].IsLeader).Should(BeTrue())
+		Expect(queue()).To(Equal([]string{"candidate-1", "candidate-0"}))
+		Expect(candidates[0].Resign(ctx, election.Leave)).To(Succeed())
+		Eventually(candidates[0].State).Should(Equal(election.Stopped))
+		Expect(candidates[0].Resign(ctx, election.Rejoin)).To(MatchError(election.ErrNotRunning))
+		Expect(queue()).To(Equal([]string{"candidate-1"}))
+	})
+
+	It("must list the candidates in order and return the leader", func() {
+		start(3, election.WithAdvertisedAddress("10.0.0.1:8080"), election.WithVersion("1.2.3"))
+		infos, err := candidates[2].Candidates()
+		Expect(err).To(BeNil())
+		Expect(infos).To(HaveLen(3))
+		for i, info := range infos {
+			Expect(info.ID).To(Equal(candidates[i].ID))
+			Expect(info.Address).To(Equal("10.0.0.1:8080"))
+			Expect(info.Version).To(Equal("1.2.3"))
+			Expect(info.Hostname).NotTo(BeEmpty())
+			Expect(info.StartTime).NotTo(BeZero())
+		}
+		leader, err := candidates[1].GetLeader()
+		Expect(err).To(BeNil())
+		Expect(leader.ID).To(Equal("candidate-0"))
+		candidates[0].Cancel()
+		Eventually(func() string {
+			leader, _ := candidates[2].GetLeader()
+			return leader.ID
+		}).Should(Equal("candidate-1"))
+		// candidates without a payload are listed with their znode only
+		_, err = admin.Create(Namespace+"/c_", []byte{}, coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+		infos, err = candidates[1].Candidates()
+		Expect(err).To(BeNil())
+		Expect(infos).To(HaveLen(3))
+		Expect(infos[2].ID).To(BeEmpty())
+		Expect(infos[2].Znode).NotTo(BeEmpty())
+	})
+
+	It("must become the leader with Run and delete its znode once the caller's context is done", func() {
+		runCtx, runCancel := context.WithCancel(ctx)
+		defer runCancel()
+		candidate, err := election.New(nil, Namespace, election.WithBackend(store), election.WithID("node-1"))
+		Expect(err).To(BeNil())
+		runErr := make(chan error, 1)
+		go func() {
+			runErr <- candidate.Run(runCtx)
+		}()
+		Expect(candidate.WaitForLeadership(ctx)).To(Succeed())
+		leader, err := candidate.GetLeader()
+		Expect(err).To(BeNil())
+		Expect(leader.ID).To(Equal("node-1"))
+		Consistently(runErr, 100*time.Millisecond).ShouldNot(Receive())
+		runCancel()
+		Eventually(runErr).Should(Receive(BeNil()))
+		Expect(candidate.State()).To(Equal(election.Stopped))
+		Eventually(queue).Should(BeEmpty())
+	})
+
+	It("must report a missing namespace with a typed error", func() {
+		candidate, err := election.New(nil, "/missing-election-namespace", election.WithBackend(store))
+		Expect(err).To(BeNil())
+		err = candidate.Run(ctx)
+		var namespaceErr *election.NamespaceNotFoundError
+		Expect(errors.As(err, &namespaceErr)).To(BeTrue())
+		Expect(namespaceErr.Namespace).To(Equal("/missing-election-namespace"))
+		Expect(candidate.State()).To(Equal(election.Stopped))
+	})
+
+	It("must create the missing namespace recursively", func() {
+		for _, mode := range []election.NamespaceMode{election.PersistentNamespace, election.ContainerNamespace} {
+			nestedNamespace := fmt.Sprintf("%s/nested-%d/election", Namespace, mode)
+			candidate, err := election.New(nil, nestedNamespace, election.WithBackend(store), election.WithCreateNamespace(mode))
+			Expect(err).To(BeNil())
+			candidates = append(candidates, candidate)
+			go candidate.Run(ctx)
+			Expect(candidate.WaitForLeadership(ctx)).To(Succeed())
+			children, err := admin.Children(nestedNamespace)
+			Expect(err).To(BeNil())
+			Expect(children).To(HaveLen(1))
+		}
+	})
+
+	It("must run a function only while leader and wait for it before volunteering again", func() {
+		start(2)
+		started := make(chan int64, 2)
+		release := make(chan struct{})
+		go candidates[0].RunWhileLeader(ctx, func(leaderCtx context.Context) error {
+			token, _ := election.FencingTokenFromContext(leaderCtx)
+			started <- token
+			<-leaderCtx.Done()
+			<-release
+			return nil
+		})
+		var firstToken int64
+		Eventually(started).Should(Receive(&firstToken))
+		session(candidates[0]).Expire()
+		Eventually(candidates[1].IsLeader).Should(BeTrue())
+		// the function has not returned yet so the node does not volunteer again
+		Consistently(queue, 200*time.Millisecond).Should(Equal([]string{"candidate-1"}))
+		close(release)
+		Eventually(queue).Should(Equal([]string{"candidate-1", "candidate-0"}))
+		Expect(candidates[1].Resign(ctx, election.Leave)).To(Succeed())
+		var secondToken int64
+		Eventually(started).Should(Receive(&secondToken))
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+	})
+
+	It("must resign when the function run while leader fails", func() {
+		start(2)
+		go candidates[0].RunWhileLeader(ctx, func(leaderCtx context.Context) error {
+			return errors.New("failed")
+		})
+		Eventually(candidates[1].IsLeader).Should(BeTrue())
+		Expect(queue()).To(Equal([]string{"candidate-1", "candidate-0"}))
+		Expect(candidates[0].State()).To(Equal(election.Follower))
+	})
+
+	It("must let the function run while leader resign or stop with its own context", func() {
+		start(3)
+		resigned := make(chan error, 1)
+		go candidates[0].RunWhileLeader(ctx, func(leaderCtx context.Context) error {
+			resigned <- candidates[0].Resign(leaderCtx, election.Rejoin)
+			return nil
+		})
+		Eventually(resigned).Should(Receive(BeNil()))
+		Eventually(candidates[1].IsLeader).Should(BeTrue())
+		Eventually(queue).Should(Equal([]string{"candidate-1", "candidate-2", "candidate-0"}))
+		stopped := make(chan error, 1)
+		go candidates[1].RunWhileLeader(ctx, func(leaderCtx context.Context) error {
+			stopped <- candidates[1].Stop(leaderCtx)
+			<-leaderCtx.Done()
+			return nil
+		})
+		Eventually(stopped).Should(Receive(BeNil()))
+		Eventually(candidates[1].State).Should(Equal(election.Stopped))
+		Eventually(candidates[2].IsLeader).Should(BeTrue())
+		Expect(queue()).To(Equal([]string{"candidate-2", "candidate-0"}))
+	})
+
+	It("must stop running the function when its context is done or the election stops", func() {
+		start(1)
+		runCtx, runCancel := context.WithCancel(ctx)
+		returned := make(chan error, 2)
+		running := make(chan struct{}, 2)
+		run := func(ctx context.Context) {
+			returned <- candidates[0].RunWhileLeader(ctx, func(leaderCtx context.Context) error {
+				running <- struct{}{}
+				<-leaderCtx.Done()
+				return nil
+			})
+		}
+		go run(runCtx)
+		go run(ctx)
+		Eventually(running).Should(Receive())
+		Eventually(running).Should(Receive())
+		runCancel()
+		Eventually(returned).Should(Receive(MatchError(context.Canceled)))
+		Expect(candidates[0].IsLeader()).To(BeTrue())
+		Expect(candidates[0].Resign(ctx, election.Leave)).To(Succeed())
+		Eventually(returned).Should(Receive(MatchError(election.ErrElectionStopped)))
+	})
+
+	It("must release the leadership and the session synchronously when stopped", func() {
+		start(2)
+		running, revoked := make(chan struct{}), make(chan struct{})
+		returned := make(chan error, 1)
+		go func() {
+			returned <- candidates[0].RunWhileLeader(ctx, func(leaderCtx context.Context) error {
+				close(running)
+				<-leaderCtx.Done()
+				close(revoked)
+				return nil
+			})
+		}()
+		Eventually(running).Should(BeClosed())
+		Expect(store.Sessions()).To(HaveLen(3))
+		Expect(candidates[0].Stop(ctx)).To(Succeed())
+		// nothing is left to wait for once Stop has returned
+		Expect(candidates[0].State()).To(Equal(election.Stopped))
+		Expect(revoked).To(BeClosed())
+		Expect(queue()).To(Equal([]string{"candidate-1"}))
+		Expect(store.Sessions()).To(HaveLen(2))
+		Eventually(candidates[1].IsLeader).Should(BeTrue())
+		Eventually(returned).Should(Receive(MatchError(election.ErrElectionStopped)))
+		Expect(candidates[0].Stop(ctx)).To(Succeed())
+	})
+
+	It("must let Resign and Stop race with the start of the election", func() {
+		for i := 0; i < 20; i++ {
+			candidate, err := election.New(nil, Namespace,
+				election.WithBackend(store),
+				election.WithBackoff(backoff.NewConstantBackOff(10*time.Millisecond)),
+			)
+			Expect(err).To(BeNil())
+			candidates = append(candidates, candidate)
+			resigned := make(chan error, 1)
+			go func() {
+				resigned <- candidate.Resign(ctx, election.Leave)
+			}()
+			go candidate.Run(ctx)
+			// a Resign that comes before Run finds nothing to resign
+			Eventually(resigned).Should(Receive(SatisfyAny(BeNil(), MatchError(election.ErrNotRunning))))
+			Expect(candidate.Stop(ctx)).To(SatisfyAny(Succeed(), MatchError(election.ErrNotRunning)))
+		}
+	})
+
+	It("must refuse to stop an election that was never started", func() {
+		candidate, err := election.New(nil, Namespace, election.WithBackend(store))
+		Expect(err).To(BeNil())
+		Expect(candidate.Stop(ctx)).To(MatchError(election.ErrNotRunning))
+	})
+
+	It("must stop the election when the process receives a signal", func() {
+		start(2)
+		remove := candidates[0].StopOnSignal(time.Second, syscall.SIGHUP)
+		defer remove()
+		process, err := os.FindProcess(os.Getpid())
+		Expect(err).To(BeNil())
+		Expect(process.Signal(syscall.SIGHUP)).To(Succeed())
+		Eventually(candidates[0].State).Should(Equal(election.Stopped))
+		Eventually(candidates[1].IsLeader).Should(BeTrue())
+		Expect(queue()).To(Equal([]string{"candidate-1"}))
+	})
+
+	It("must hand over to the live candidate with the highest priority and break ties by sequence", func() {
+		start(1, election.WithPriority(0))
+		start(1, election.WithPriority(5))
+		start(1, election.WithPriority(10))
+		start(1, election.WithPriority(10))
+		// without preemption the leader keeps the leadership
+		Consistently(candidates[0].IsLeader, 300*time.Millisecond).Should(BeTrue())
+		infos, err := election.ListCandidates(admin, Namespace)
+		Expect(err).To(BeNil())
+		Expect(infos[2].Priority).To(Equal(10))
+		Expect(candidates[0].Resign(ctx, election.Leave)).To(Succeed())
+		Eventually(candidates[2].IsLeader).Should(BeTrue())
+		Expect(candidates[1].IsLeader()).To(BeFalse())
+		Expect(candidates[3].IsLeader()).To(BeFalse())
+		Expect(candidates[2].Resign(ctx, election.Leave)).To(Succeed())
+		Eventually(candidates[3].IsLeader).Should(BeTrue())
+		Expect(queue()).To(Equal([]string{"candidate-3", "candidate-1"}))
+	})
+
+	It("must let a candidate with a higher priority take over when preemption is on", func() {
+		start(1, election.WithPriority(1), election.WithPreemption())
+		Expect(candidates[0].IsLeader()).To(BeTrue())
+		firstToken, _ := candidates[0].FencingToken()
+		start(1, election.WithPriority(0), election.WithPreemption())
+		Consistently(candidates[0].IsLeader, 300*time.Millisecond).Should(BeTrue())
+		start(1, election.WithPriority(2), election.WithPreemption())
+		Eventually(candidates[2].IsLeader).Should(BeTrue())
+		Expect(candidates[0].IsLeader()).To(BeFalse())
+		secondToken, _ := candidates[2].FencingToken()
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+		// the former leader moved behind the new one but still goes before the lower priority candidate
+		Expect(candidates[2].Resign(ctx, election.Leave)).To(Succeed())
+		Eventually(candidates[0].IsLeader).Should(BeTrue())
+		Consistently(candidates[0].IsLeader, 300*time.Millisecond).Should(BeTrue())
+	})
+
+	It("must not let a fenced leader yield to a candidate with a higher priority on reconnect without preemption", func() {
+		opts := []election.Option{election.WithTimeout(time.Second), election.WithDisconnectPolicy(election.FenceOnDisconnect), election.WithFenceTimeout(100 * time.Millisecond)}
+		start(1, append(opts, election.WithPriority(0))...)
+		start(1, append(opts, election.WithPriority(10))...)
+		leaderSession := session(candidates[0])
+		leaderSession.Disconnect()
+		Eventually(candidates[0].State).Should(Equal(election.Disconnected))
+		leaderSession.Reconnect()
+		Eventually(candidates[0].IsLeader).Should(BeTrue())
+		Consistently(candidates[0].IsLeader, 300*time.Millisecond).Should(BeTrue())
+		Expect(queue()).To(Equal([]string{"candidate-0", "candidate-1"}))
+	})
+
+	It("must only read the priority of the candidates it has not seen yet", func() {
+		var gets atomic.Int64
+		leader, err := election.New(nil, Namespace,
+			election.WithBackend(countingBackend{Backend: store, gets: &gets}),
+			election.WithBackoff(backoff.NewConstantBackOff(10*time.Millisecond)),
+			election.WithPriority(10),
+			election.WithPreemption(),
+		)
+		Expect(err).To(BeNil())
+		candidates = append(candidates, leader)
+		go leader.Run(ctx)
+		Eventually(leader.IsLeader).Should(BeTrue())
+		// every candidate that joins changes the children, the ones already seen must not be read again
+		start(5)
+		Consistently(leader.IsLeader, 100*time.Millisecond).Should(BeTrue())
+		Expect(gets.Load()).To(BeNumerically("<=", 5))
+	})
+
+	It("must let an observer follow the leader", func() {
+		start(2)
+		observer := &election.Observer{ZkNamespace: Namespace, ZkTimeout: Timeout, Backend: store}
+		go observer.Run(ctx)
+		defer observer.Stop(ctx)
+		var leader election.CandidateInfo
+		Eventually(observer.Changes()).Should(Receive(&leader))
+		Expect(leader.ID).To(Equal("candidate-0"))
+		Expect(candidates[0].Resign(ctx, election.Leave)).To(Succeed())
+		Eventually(observer.Changes()).Should(Receive(&leader))
+		Expect(leader.ID).To(Equal("candidate-1"))
+	})
+	It("must stop the observer with the context given to Run or with Stop", func() {
+		observer := &election.Observer{ZkNamespace: Namespace, ZkTimeout: Timeout, Backend: store}
+		Expect(observer.Stop(ctx)).To(MatchError(election.ErrNotRunning))
+		observerCtx, observerCancel := context.WithCancel(ctx)
+		returned := make(chan error, 1)
+		go func() {
+			returned <- observer.Run(observerCtx)
+		}()
+		Eventually(store.Sessions).Should(HaveLen(2))
+		observerCancel()
+		Eventually(returned).Should(Receive(BeNil()))
+		Expect(store.Sessions()).To(HaveLen(1))
+		go observer.Run(ctx)
+		Eventually(store.Sessions).Should(HaveLen(2))
+		Expect(observer.Stop(ctx)).To(Succeed())
+		Expect(store.Sessions()).To(HaveLen(1))
+	})
+
+	It("must not report a first candidate that is about to let a candidate with a higher priority go first as the leader", func() {
+		observer := &election.Observer{ZkNamespace: Namespace, ZkTimeout: Timeout, Backend: store}
+		go observer.Run(ctx)
+		defer observer.Stop(ctx)
+		first, err := admin.Create(Namespace+"/c_", []byte(`{"id":"first"}`), coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+		var leader election.CandidateInfo
+		Eventually(observer.Changes()).Should(Receive(&leader))
+		Expect(leader.ID).To(Equal("first"))
+		_, err = admin.Create(Namespace+"/c_", []byte(`{"id":"second","priority":1}`), coordination.EphemeralSequential)
+		Expect(err).To(BeNil())
+		Eventually(observer.Changes()).Should(Receive(Equal(election.CandidateInfo{})))
+		// the first candidate won the election before the second one joined, so it keeps the leadership
+		_, err = admin.Set(first, []byte(`{"id":"first","elected":true}`))
+		Expect(err).To(BeNil())
+		Eventually(observer.Changes()).Should(Receive(&leader))
+		Expect(leader.ID).To(Equal("first"))
+	})
+
+	It("must hand over from the leader to the candidate with the highest priority without announcing the ones that yield", func() {
+		start(1, election.WithPriority(0))
+		start(1, election.WithPriority(0))
+		start(1, election.WithPriority(10))
+		observer := &election.Observer{ZkNamespace: Namespace, ZkTimeout: Timeout, Backend: store}
+		go observer.Run(ctx)
+		defer observer.Stop(ctx)
+		var leader election.CandidateInfo
+		Eventually(observer.Changes()).Should(Receive(&leader))
+		Expect(leader.ID).To(Equal("candidate-0"))
+		announced := make(chan string, 10)
+		go func() {
+			for leader := range observer.Changes() {
+				if leader.ID != "" {
+					announced <- leader.ID
+				}
+			}
+		}()
+		Expect(candidates[0].Resign(ctx, election.Leave)).To(Succeed())
+		Eventually(candidates[2].IsLeader).Should(BeTrue())
+		Eventually(func() string {
+			leader, _ := observer.Leader()
+			return leader.ID
+		}).Should(Equal("candidate-2"))
+		// there may be no leader for a moment, but the candidate that yields is never announced
+		var id string
+		Eventually(announced).Should(Receive(&id))
+		Expect(id).To(Equal("candidate-2"))
+		Expect(announced).NotTo(Receive())
+		leader, err = candidates[1].GetLeader()
+		Expect(err).To(BeNil())
+		Expect(leader.ID).To(Equal("candidate-2"))
+	})
+
+	It("must validate the TLS configuration of the observer", func() {
+		observer := &election.Observer{ZkNamespace: Namespace, ZkTimeout: Timeout, Backend: store, TLS: &utils.TLSConfig{CAFile: "/nonexistent/ca.pem"}}
+		Expect(observer.Run(ctx)).To(MatchError(ContainSubstring("CA bundle")))
+	})
+
+	It("must not set the children watch again when the observer reconnects within its session", func() {
+		start(2)
+		observer := &election.Observer{ZkNamespace: Namespace, ZkTimeout: Timeout, Backend: store}
+		go observer.Run(ctx)
+		defer observer.Stop(ctx)
+		Eventually(observer.Changes()).Should(Receive())
+		sessions := store.Sessions()
+		observerSession := sessions[len(sessions)-1]
+		watches := store.Watches()
+		for i := 0; i < 5; i++ {
+			observerSession.Disconnect()
+			observerSession.Reconnect()
+		}
+		Consistently(store.Watches, 200*time.Millisecond).Should(Equal(watches))
+		Expect(candidates[0].Resign(ctx, election.Leave)).To(Succeed())
+		var leader election.CandidateInfo
+		Eventually(observer.Changes()).Should(Receive(&leader))
+		Expect(leader.ID).To(Equal("candidate-1"))
+	})
+})
+
+// countingBackend counts the reads of znode data done by the sessions it opens
+type countingBackend struct {
+	coordination.Backend
+	gets *atomic.Int64
+}
+
+func (b countingBackend) Connect() (coordination.Session, error) {
+	session, err := b.Backend.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return countingSession{Session: session, gets: b.gets}, nil
+}
+
+// countingSession is a session whose reads of znode data are counted
+type countingSession struct {
+	coordination.Session
+	gets *atomic.Int64
+}
+
+func (s countingSession) Get(path string) ([]byte, coordination.Stat, error) {
+	s.gets.Add(1)
+	return s.Session.Get(path)
+}
@@ -0,0 +1,56 @@
+package election
+
+import (
+	"strings"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+)
+
+// NamespaceMode is the kind of znodes created for the namespace when CreateNamespace is set
+type NamespaceMode int
+
+const (
+	// PersistentNamespace creates the namespace with persistent znodes that stay until they are deleted manually
+	PersistentNamespace NamespaceMode = iota
+	// ContainerNamespace creates the namespace with container znodes that zookeeper deletes once they have no children left
+	ContainerNamespace
+)
+
+// ensureNamespace checks that the namespace exists and creates it if CreateNamespace is set
+// it returns a NamespaceNotFoundError if the namespace does not exist and CreateNamespace is not set
+func (l *LeaderElection) ensureNamespace() error {
+	l.Log.Info().Msg("Checking namespace exists")
+	exists, _, err := l.conn.Exists(l.ZkNamespace)
+	if err != nil {
+		l.Log.Info().Err(err).Msg("Failed to check if namespace exists")
+		return err
+	}
+	if exists {
+		return nil
+	}
+	if !l.CreateNamespace {
+		l.Log.Info().Msg("Namespace does not exist. You must create it or set CreateNamespace")
+		return &NamespaceNotFoundError{Namespace: l.ZkNamespace}
+	}
+	return l.createNamespace()
+}
+
+// createNamespace creates every znode of the namespace path that does not exist yet
+// the zookeeper backend gives them NamespaceACL when it is set
+func (l *LeaderElection) createNamespace() error {
+	l.Log.Info().Msgf("Creating namespace %s", l.ZkNamespace)
+	path := ""
+	for _, part := range strings.Split(strings.Trim(l.ZkNamespace, "/"), "/") {
+		path += "/" + part
+		mode := coordination.Persistent
+		if l.NamespaceMode == ContainerNamespace {
+			mode = coordination.Container
+		}
+		_, err := l.conn.Create(path, []byte{}, mode)
+		if err != nil && err != coordination.ErrNodeExists {
+			l.Log.Info().Err(err).Msgf("Failed to create %s", path)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package election
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
+)
+
+// Observer follows the leader of an election without taking part in it
+// It watches the children of the namespace and never creates a candidate znode
+type Observer struct {
+	// ZkNamespace is the namespace on zookeeper that is used by the election
+	ZkNamespace string
+	// ZkTimeout is the timeout for the zookeeper connection
+	ZkTimeout time.Duration
+	// Zookeepers is a list of zookeeper servers. It is not needed when Backend is set
+	Zookeepers []string
+	// Backend is the coordination store used by the election
+	// The default value is a zookeeper backend built from Zookeepers, ZkTimeout, TLS and DigestAuth
+	Backend coordination.Backend
+	// DigestAuth are the credentials used to authenticate the connection with the digest scheme
+	// They are only needed if the candidate znodes are not readable by everyone
+	DigestAuth *DigestCredentials
+	// TLS is the configuration used to encrypt the connection to zookeeper. If it is not provided, the connection is plain TCP
+	TLS *utils.TLSConfig
+	// Log is logger that will be used. If you don't provide a logger, it will use the default logger
+	Log *zerolog.Logger
+	// Backoff is the backoff strategy that will be used to reconnect
+	// The default value is an exponential backoff that retries forever
+	Backoff backoff.BackOff
+	// Cancel is the cancel function for the context that will be used to stop the observer
+	Cancel context.CancelFunc
+	// Ctx is the context that will be used to stop the observer, it is derived from the context given to Run
+	Ctx context.Context
+	// stopMu protects Ctx, Cancel and loopDone against the callers of Stop
+	stopMu sync.Mutex
+	// loopDone is closed once the observing loop has exited, it is nil until the loop is started
+	loopDone chan struct{}
+	// conn is the session with the coordination store
+	conn coordination.Session
+	// connectionWatcher is the channel that will be used to watch for connection events
+	connectionWatcher <-chan coordination.Event
+	// mu protects leader, hasLeader and changes
+	mu sync.Mutex
+	// leader is the identity of the current leader
+	leader CandidateInfo
+	// hasLeader is true when there is a leader
+	hasLeader bool
+	// changes receives the identity of the new leader on every change
+	changes chan CandidateInfo
+}
+
+// defaultConfig initializes the recommended default values for the observer
+func (o *Observer) defaultConfig() {
+	if o.Backoff == nil {
+		bckoff := backoff.NewExponentialBackOff()
+		bckoff.MaxElapsedTime = 0
+		o.Backoff = bckoff
+	}
+	if o.Log == nil {
+		o.Log = &log.Logger
+	}
+}
+
+// Leader returns the identity of the current leader and false if there is no leader
+func (o *Observer) Leader() (CandidateInfo, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.leader, o.hasLeader
+}
+
+// Changes returns a channel that receives the identity of the new leader every time the leader changes
+// a zero CandidateInfo is sent when there is no leader anymore
+// only the latest change is kept if the channel is not drained in time
+func (o *Observer) Changes() <-chan CandidateInfo {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.changesLocked()
+}
+
+// changesLocked returns the changes channel, creating it if needed. mu must be held
+func (o *Observer) changesLocked() chan CandidateInfo {
+	if o.changes == nil {
+		o.changes = make(chan CandidateInfo, 1)
+	}
+	return o.changes
+}
+
+// Run follows the leader until ctx is done or Stop is called
+// it blocks the calling goroutine, the connection is retried with the backoff strategy
+// it returns an error only when the configuration is invalid
+func (o *Observer) Run(ctx context.Context) error {
+	o.defaultConfig()
+	err := o.validateConfig()
+	if err != nil {
+		return err
+	}
+	o.start(ctx)
+	o.observe(o.connect())
+	return nil
+}
+
+// StartObserving connects to zookeeper and starts following the leader in a goroutine
+// the connection is retried with the backoff strategy until the observer is cancelled
+//
+// Deprecated: use Run, which honors the caller's context
+func (o *Observer) StartObserving() error {
+	o.defaultConfig()
+	err := o.validateConfig()
+	if err != nil {
+		return err
+	}
+	o.start(context.Background())
+	err = o.connect()
+	if err != nil {
+		o.Cancel()
+		close(o.loopDone)
+		return err
+	}
+	go o.observe(nil)
+	return nil
+}
+
+// Stop stops following the leader and returns once the observing loop has exited and the connection is closed
+// it returns ctx.Err() if ctx is done first and ErrNotRunning if the observer was never started
+func (o *Observer) Stop(ctx context.Context) error {
+	o.stopMu.Lock()
+	done, cancel := o.loopDone, o.Cancel
+	o.stopMu.Unlock()
+	if done == nil {
+		return ErrNotRunning
+	}
+	cancel()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+// start derives the context of the observer from parent and creates the channel that Stop waits on
+func (o *Observer) start(parent context.Context) {
+	o.stopMu.Lock()
+	defer o.stopMu.Unlock()
+	o.Ctx, o.Cancel = context.WithCancel(parent)
+	o.loopDone = make(chan struct{})
+}
+
+// observe follows the leader until the observer is cancelled
+// err is the result of the first connection attempt, the connection is retried with backoff when it is not nil
+func (o *Observer) observe(err error) {
+	defer close(o.loopDone)
+	defer o.Cancel()
+	defer func() {
+		if o.conn != nil {
+			o.conn.Close()
+		}
+	}()
+	for {
+		if err == nil {
+			err = o.watchLeader()
+			if err == nil {
+				o.Log.Info().Msg("Context cancelled. Exiting")
+				return
+			}
+			o.Log.Info().Err(err).Msg("Failed to watch the leader")
+		}
+		// reconnect with backoff until it works or the observer is cancelled
+		for err != nil {
+			select {
+			case <-o.Ctx.Done():
+				o.Log.Info().Msg("Context cancelled. Exiting")
+				return
+			case <-time.After(o.Backoff.NextBackOff()):
+				err = o.connect()
+				if err != nil {
+					o.Log.Info().Err(err).Msg("Failed connecting to zookeeper")
+				}
+			}
+		}
+	}
+}
+
+// connect establishes a new connection to zookeeper, closing the previous one
+func (o *Observer) connect() error {
+	o.Log.Info().Msg("Connecting to zookeeper")
+	if o.conn != nil {
+		o.conn.Close()
+	}
+	conn, err := o.backend().Connect()
+	if err != nil {
+		return err
+	}
+	o.conn, o.connectionWatcher = conn, conn.Events()
+	return nil
+}
+
+// watchLeader watches the children of the namespace and updates the leader on every change
+// the children watch is only set again once it has fired, it survives the disconnects of the session
+// while the first candidate has not won the election yet, its znode is watched too so that its victory is noticed
+// it returns nil when the observer is cancelled and an error when the connection must be established again
+func (o *Observer) watchLeader() error {
+	var childrenWatcher, firstWatcher <-chan coordination.Event
+	var children []string
+	var first string
+	stale := true
+	for {
+		if stale {
+			var err error
+			if childrenWatcher == nil {
+				children, childrenWatcher, err = o.conn.ChildrenW(o.ZkNamespace)
+				if err != nil {
+					return err
+				}
+			}
+			candidates, err := o.updateLeader(children)
+			// when a candidate went away while we were reading it, the watch fires and the children are read again
+			if err != nil && err != coordination.ErrNoNode {
+				return err
+			}
+			if len(candidates) > 0 && !candidates[0].Elected && (firstWatcher == nil || first != candidates[0].Znode) {
+				first = candidates[0].Znode
+				_, _, firstWatcher, err = o.conn.ExistsW(o.ZkNamespace + "/" + first)
+				if err != nil {
+					return err
+				}
+			}
+			stale = false
+			o.Backoff.Reset()
+		}
+		select {
+		case <-o.Ctx.Done():
+			return nil
+		case event := <-childrenWatcher:
+			if event.Err != nil {
+				return event.Err
+			}
+			childrenWatcher, stale = nil, true
+		case event := <-firstWatcher:
+			if event.Err != nil {
+				return event.Err
+			}
+			firstWatcher, stale = nil, true
+		case event, ok := <-o.connectionWatcher:
+			if !ok {
+				return coordination.ErrClosed
+			}
+			if event.State == coordination.StateExpired {
+				return coordination.ErrSessionExpired
+			}
+		}
+	}
+}
+
+// updateLeader reads the candidates and publishes the leader if it changed, the leader is found with the same rules as GetLeader
+func (o *Observer) updateLeader(children []string) ([]CandidateInfo, error) {
+	candidates, err := readCandidates(o.conn, o.ZkNamespace, append([]string{}, children...))
+	if err != nil {
+		return nil, err
+	}
+	leader, hasLeader := leaderOf(candidates)
+	o.mu.Lock()
+	changed := hasLeader != o.hasLeader || leader.Znode != o.leader.Znode
+	o.leader, o.hasLeader = leader, hasLeader
+	changes := o.changesLocked()
+	o.mu.Unlock()
+	if !changed {
+		return candidates, nil
+	}
+	o.Log.Info().Msgf("Leader is now %q", leader.ID)
+	// keep only the latest change in the channel
+	select {
+	case <-changes:
+	default:
+	}
+	changes <- leader
+	return candidates, nil
+}
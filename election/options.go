@@ -0,0 +1,165 @@
+package election
+
+import (
+	"context"
+	"time"
+
+	backoff "github.com/cenkalti/backoff/v4"
+	"github.com/go-zookeeper/zk"
+	"github.com/rs/zerolog"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
+)
+
+// DefaultZkTimeout is the zookeeper session timeout used by New when WithTimeout is not given
+const DefaultZkTimeout = 10 * time.Second
+
+// Option configures a LeaderElection created with New
+type Option func(*LeaderElection)
+
+// New returns a LeaderElection for the given zookeeper servers and namespace, configured with the given options
+// zookeepers may be empty when the coordination store is given with WithBackend
+// the configuration is validated but nothing is started until Run is called
+func New(zookeepers []string, namespace string, opts ...Option) (*LeaderElection, error) {
+	l := &LeaderElection{
+		Zookeepers:  zookeepers,
+		ZkNamespace: namespace,
+		ZkTimeout:   DefaultZkTimeout,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	l.defaultConfig()
+	err := l.validateConfig()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// WithTimeout sets the timeout for the zookeeper connection and the session
+func WithTimeout(timeout time.Duration) Option {
+	return func(l *LeaderElection) {
+		l.ZkTimeout = timeout
+	}
+}
+
+// WithLogger sets the logger
+func WithLogger(logger *zerolog.Logger) Option {
+	return func(l *LeaderElection) {
+		l.Log = logger
+	}
+}
+
+// WithBackoff sets the backoff strategy used to retry the election
+func WithBackoff(b backoff.BackOff) Option {
+	return func(l *LeaderElection) {
+		l.Backoff = b
+	}
+}
+
+// WithOnElected sets the callback called when the node becomes the leader
+func WithOnElected(onElected func(ctx context.Context)) Option {
+	return func(l *LeaderElection) {
+		l.OnElected = onElected
+	}
+}
+
+// WithOnRevoked sets the callback called when the node loses the leadership
+func WithOnRevoked(onRevoked func()) Option {
+	return func(l *LeaderElection) {
+		l.OnRevoked = onRevoked
+	}
+}
+
+// WithDisconnectPolicy sets what happens to the leadership when the connection is lost
+func WithDisconnectPolicy(policy DisconnectPolicy) Option {
+	return func(l *LeaderElection) {
+		l.DisconnectPolicy = policy
+	}
+}
+
+// WithFenceTimeout sets how long after its last successful contact with the server a disconnected leader keeps the leadership with the FenceOnDisconnect policy
+func WithFenceTimeout(timeout time.Duration) Option {
+	return func(l *LeaderElection) {
+		l.FenceTimeout = timeout
+	}
+}
+
+// WithID sets the unique identifier published in the candidate znode
+func WithID(id string) Option {
+	return func(l *LeaderElection) {
+		l.ID = id
+	}
+}
+
+// WithAdvertisedAddress sets the address published in the candidate znode
+func WithAdvertisedAddress(address string) Option {
+	return func(l *LeaderElection) {
+		l.AdvertisedAddress = address
+	}
+}
+
+// WithVersion sets the version published in the candidate znode
+func WithVersion(version string) Option {
+	return func(l *LeaderElection) {
+		l.Version = version
+	}
+}
+
+// WithPriority sets the priority published in the candidate znode, the live candidate with the highest priority becomes the leader
+func WithPriority(priority int) Option {
+	return func(l *LeaderElection) {
+		l.Priority = priority
+	}
+}
+
+// WithPreemption makes the leader hand the leadership over as soon as a candidate with a higher priority joins
+func WithPreemption() Option {
+	return func(l *LeaderElection) {
+		l.Preempt = true
+	}
+}
+
+// WithCreateNamespace creates the namespace and its parents with the given kind of znodes if they do not exist
+func WithCreateNamespace(mode NamespaceMode) Option {
+	return func(l *LeaderElection) {
+		l.CreateNamespace = true
+		l.NamespaceMode = mode
+	}
+}
+
+// WithNamespaceACL sets the ACL of the znodes created for the namespace
+func WithNamespaceACL(acl ...zk.ACL) Option {
+	return func(l *LeaderElection) {
+		l.NamespaceACL = acl
+	}
+}
+
+// WithDigestAuth authenticates the connection with the digest scheme
+func WithDigestAuth(user, password string) Option {
+	return func(l *LeaderElection) {
+		l.DigestAuth = &DigestCredentials{User: user, Password: password}
+	}
+}
+
+// WithACLProvider sets the provider of the ACL of the znodes created by the election
+func WithACLProvider(provider ACLProvider) Option {
+	return func(l *LeaderElection) {
+		l.ACLProvider = provider
+	}
+}
+
+// WithBackend runs the election on the given coordination store instead of the zookeeper servers
+func WithBackend(backend coordination.Backend) Option {
+	return func(l *LeaderElection) {
+		l.Backend = backend
+	}
+}
+
+// WithTLS encrypts the connection to zookeeper with the given configuration
+func WithTLS(config *utils.TLSConfig) Option {
+	return func(l *LeaderElection) {
+		l.TLS = config
+	}
+}
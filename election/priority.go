@@ -0,0 +1,57 @@
+package election
+
+import (
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+)
+
+// yieldsLeadership is called when the current node is first in the queue, it tells if the node must let a candidate with a higher priority go first
+// a candidacy that has already won the election only yields when Preempt is set, even if it was fenced or disconnected in between, in which case it also keeps watching the candidates to notice the ones joining
+func (l *LeaderElection) yieldsLeadership(children []string) (bool, error) {
+	if l.Preempt {
+		var err error
+		children, l.watchCandidates, err = l.conn.ChildrenW(l.ZkNamespace)
+		if err != nil {
+			return false, err
+		}
+	} else if l.led {
+		return false, nil
+	}
+	return l.higherPriorityWaiting(children)
+}
+
+// higherPriorityWaiting tells if one of the children has a higher priority than the current node
+// the data of a candidate znode never changes, so only the children that were not seen before are read, and the ones that went away are forgotten
+// candidates that go away while they are being read and candidates that cannot be decoded are skipped
+func (l *LeaderElection) higherPriorityWaiting(children []string) (bool, error) {
+	priorities := make(map[string]int, len(children))
+	for _, child := range children {
+		if child == l.currentZnodeName {
+			continue
+		}
+		priority, ok := l.priorities[child]
+		if !ok {
+			data, _, err := l.conn.Get(l.ZkNamespace + "/" + child)
+			if err == coordination.ErrNoNode {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			info, err := decodeCandidateInfo(child, data)
+			if err != nil {
+				l.Log.Info().Err(err).Msg("Skipping candidate")
+				continue
+			}
+			priority = info.Priority
+		}
+		priorities[child] = priority
+	}
+	l.priorities = priorities
+	for child, priority := range priorities {
+		if priority > l.Priority {
+			l.Log.Info().Msgf("Candidate %s has a higher priority %d than %d", child, priority, l.Priority)
+			return true, nil
+		}
+	}
+	return false, nil
+}
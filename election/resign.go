@@ -0,0 +1,92 @@
+package election
+
+import (
+	"context"
+	"errors"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+)
+
+// ResignMode decides what the node does after resigning
+type ResignMode int
+
+const (
+	// Rejoin volunteers again right after resigning, the node is put at the back of the queue of candidates
+	Rejoin ResignMode = iota
+	// Leave leaves the election entirely, the election loop exits and the connection is closed
+	Leave
+)
+
+// errLeftElection is returned by processEvents when the node left the election through Resign
+var errLeftElection = errors.New("left the election")
+
+// resignRequest is sent by Resign to the election goroutine
+type resignRequest struct {
+	mode ResignMode
+	done chan error
+}
+
+// Resign deletes the znode of the current node so that the next candidate takes over immediately
+// the leadership is dropped before the znode is deleted so the old and the new leader never overlap
+// depending on the mode, the node either volunteers again at the back of the queue or leaves the election entirely
+// it blocks until the election goroutine has handled the request or the context is done
+// when it is called from a function of RunWhileLeader with the context passed to it, it returns as soon as the request is handed over since the request waits for that function to return
+// it returns ErrNotRunning if the election loop is not running
+func (l *LeaderElection) Resign(ctx context.Context, mode ResignMode) error {
+	l.stopMu.Lock()
+	requests, running := l.resignRequests, l.Ctx
+	l.stopMu.Unlock()
+	if requests == nil || running == nil {
+		return ErrNotRunning
+	}
+	request := resignRequest{mode: mode, done: make(chan error, 1)}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-running.Done():
+		return ErrNotRunning
+	case requests <- request:
+	}
+	if l.calledWhileLeader(ctx) {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err := <-request.done:
+		return err
+	}
+}
+
+// resign is called from processEvents to handle a resign request
+func (l *LeaderElection) resign(mode ResignMode) error {
+	l.Log.Info().Msgf("Resigning with znode %s", l.currentZnodeName)
+	err := l.dropCandidacy()
+	if err != nil {
+		return err
+	}
+	if mode == Leave {
+		return nil
+	}
+	err = l.candidate()
+	if err != nil {
+		l.Log.Info().Err(err).Msg("Failed to volunteer for candidate")
+		return err
+	}
+	return l.reelectLeader()
+}
+
+// dropCandidacy drops the leadership and then deletes the znode of the current node
+func (l *LeaderElection) dropCandidacy() error {
+	l.setState(Candidate)
+	// stop watching before deleting so that our own deletion is not mistaken for a lost candidacy
+	l.watchSelf = nil
+	l.watchPredecessor = nil
+	l.watchCandidates = nil
+	err := l.conn.Delete(l.ZkNamespace + "/" + l.currentZnodeName)
+	if err != nil && err != coordination.ErrNoNode {
+		l.Log.Info().Err(err).Msg("Failed to delete znode")
+		return err
+	}
+	return nil
+}
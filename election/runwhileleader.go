@@ -0,0 +1,108 @@
+package election
+
+import (
+	"context"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/leadership"
+)
+
+// leaderHook runs the function of RunWhileLeader for every leadership term
+// its fields are protected by hooksMu
+type leaderHook struct {
+	// ctx is the context given to RunWhileLeader
+	ctx context.Context
+	fn  func(leaderCtx context.Context) error
+	// done is closed when the current run of fn returns, it is nil when fn has not been started in the current term
+	done chan struct{}
+}
+
+// leaderHookKey is the context key under which the election is stored in the context handed to the functions of RunWhileLeader
+type leaderHookKey struct{}
+
+// RunWhileLeader runs fn every time the node becomes the leader, until ctx is done or the election loop exits
+// the context passed to fn is cancelled as soon as the leadership is lost or ctx is done, and the node does not volunteer again before fn has returned
+// if fn returns an error while the node is still the leader, the node resigns with Rejoin so that another candidate gets the leadership
+// fn may call Resign or Stop with the context passed to it, they then return without waiting for fn. With any other context they wait for fn to return and never do
+// it can be called before or after Run, a node that is already the leader starts fn right away
+// it returns ctx.Err() when ctx is done and ErrElectionStopped when the election loop exits, in both cases once fn has returned
+func (l *LeaderElection) RunWhileLeader(ctx context.Context, fn func(leaderCtx context.Context) error) error {
+	hook := &leaderHook{ctx: ctx, fn: fn}
+	l.hooksMu.Lock()
+	if l.hooks == nil {
+		l.hooks = map[*leaderHook]struct{}{}
+	}
+	l.hooks[hook] = struct{}{}
+	if l.State() == Leader {
+		l.startHookLocked(hook, leadership.LeaderContext(&l.Leadership))
+	}
+	l.hooksMu.Unlock()
+	defer func() {
+		l.hooksMu.Lock()
+		delete(l.hooks, hook)
+		done := hook.done
+		l.hooksMu.Unlock()
+		// fn sees ctx done through its own context
+		if done != nil {
+			<-done
+		}
+	}()
+	for {
+		state, changed := leadership.Changes(&l.Leadership)
+		if state == Stopped {
+			return ErrElectionStopped
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// startHookLocked runs the function of the hook for the leadership term of leaderCtx. hooksMu must be held
+func (l *LeaderElection) startHookLocked(hook *leaderHook, leaderCtx context.Context) {
+	runCtx, cancel := context.WithCancel(context.WithValue(leaderCtx, leaderHookKey{}, l))
+	stop := context.AfterFunc(hook.ctx, cancel)
+	done := make(chan struct{})
+	hook.done = done
+	go func() {
+		err := hook.fn(runCtx)
+		lost := runCtx.Err() != nil
+		stop()
+		cancel()
+		// the election goroutine may be waiting for fn before it volunteers again, release it before resigning
+		close(done)
+		if lost || err == nil {
+			return
+		}
+		l.Log.Info().Err(err).Msg("Leader function failed, resigning")
+		err = l.Resign(hook.ctx, Rejoin)
+		if err != nil {
+			l.Log.Info().Err(err).Msg("Failed to resign")
+		}
+	}()
+}
+
+// calledWhileLeader tells if ctx is the context handed to a function of RunWhileLeader of this election, or is derived from it
+// Resign and Stop wait for those functions to return so they must not wait when they are called from one of them
+func (l *LeaderElection) calledWhileLeader(ctx context.Context) bool {
+	election, _ := ctx.Value(leaderHookKey{}).(*LeaderElection)
+	return election == l
+}
+
+// startHooksLocked runs the function of every hook for the new leadership term. hooksMu must be held
+func (l *LeaderElection) startHooksLocked() {
+	for hook := range l.hooks {
+		l.startHookLocked(hook, leadership.LeaderContext(&l.Leadership))
+	}
+}
+
+// waitHooksLocked waits for the function of every hook to return once the leadership is lost. hooksMu must be held
+func (l *LeaderElection) waitHooksLocked() {
+	for hook := range l.hooks {
+		if hook.done != nil {
+			<-hook.done
+			hook.done = nil
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package election
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+)
+
+// Stop drops the leadership and stops the election loop, it is the synchronous counterpart of Cancel
+// the candidate znode is deleted before the connection is closed, so the next candidate takes over right away instead of waiting for the session to expire
+// it returns once the election loop has exited, or ctx.Err() if ctx is done first in which case the loop keeps stopping in the background
+// when it is called from a function of RunWhileLeader with the context passed to it, it returns right away since the loop waits for that function to return
+// it returns ErrNotRunning if the election loop was never started
+func (l *LeaderElection) Stop(ctx context.Context) error {
+	l.stopMu.Lock()
+	done, cancel := l.loopDone, l.Cancel
+	l.stopRequested = true
+	l.stopMu.Unlock()
+	if done == nil {
+		return ErrNotRunning
+	}
+	cancel()
+	if l.calledWhileLeader(ctx) {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+// StopOnSignal calls Stop when the process receives one of the signals, or SIGINT and SIGTERM when none is given
+// timeout bounds how long Stop waits for the election loop to exit
+// the signals do not terminate the process anymore once the hook is installed, the program exits on its own once Run returns
+// the returned function removes the hook
+func (l *LeaderElection) StopOnSignal(timeout time.Duration, signals ...os.Signal) func() {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	received := make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+	removed := make(chan struct{})
+	go func() {
+		select {
+		case <-removed:
+			return
+		case sig := <-received:
+			l.Log.Info().Stringer("signal", sig).Msg("Received signal, stopping the election")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		err := l.Stop(ctx)
+		if err != nil {
+			l.Log.Info().Err(err).Msg("Failed to stop the election")
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(received)
+			close(removed)
+		})
+	}
+}
+
+// startContext derives the context of the election from parent and creates the channel of the resign requests
+// they are guarded by stopMu since Resign and Stop may be called while the election is starting
+func (l *LeaderElection) startContext(parent context.Context) {
+	l.stopMu.Lock()
+	defer l.stopMu.Unlock()
+	l.Ctx, l.Cancel = context.WithCancel(parent)
+	l.resignRequests = make(chan resignRequest)
+}
+
+// beginLoop is called once the election loop is about to start, it creates the channel that Stop waits on
+// Ctx and Cancel must be set before
+func (l *LeaderElection) beginLoop() {
+	l.stopMu.Lock()
+	defer l.stopMu.Unlock()
+	l.loopDone = make(chan struct{})
+	l.stopRequested = false
+}
+
+// exitLoop is deferred by the election loop, it drops the leadership and releases the connection
+// when Stop was called, the candidate znode is deleted first so that the next candidate does not wait for the session to expire
+func (l *LeaderElection) exitLoop() {
+	// make sure the leadership is revoked before anything else so the old and the new leader never overlap
+	l.setState(Stopped)
+	l.Cancel()
+	l.stopMu.Lock()
+	stopRequested, done := l.stopRequested, l.loopDone
+	l.stopMu.Unlock()
+	if stopRequested && l.conn != nil && l.currentZnodeName != "" {
+		l.Log.Info().Msgf("Deleting znode %s", l.currentZnodeName)
+		err := l.conn.Delete(l.ZkNamespace + "/" + l.currentZnodeName)
+		if err != nil && err != coordination.ErrNoNode {
+			l.Log.Info().Err(err).Msg("Failed to delete znode, it is removed with the session")
+		}
+	}
+	l.closeConn()
+	close(done)
+}
@@ -1,6 +1,10 @@
 package election
 
-import "github.com/go-zookeeper/zk"
+import (
+	"context"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+)
 
 func (l *LeaderElection) Candidate() error {
 	return l.candidate()
@@ -13,8 +17,9 @@ func (l *LeaderElection) ProcessEvents() error {
 	return l.processEvents()
 }
 
-func (l *LeaderElection) SetConn(conn *zk.Conn) {
-	l.conn = conn
+func (l *LeaderElection) SetSession(session coordination.Session) {
+	l.conn = session
+	l.connectionWatcher = session.Events()
 }
 
 func (l *LeaderElection) CloseConn() {
@@ -23,8 +28,19 @@ func (l *LeaderElection) CloseConn() {
 
 func (l *LeaderElection) DefaultConfig() {
 	l.defaultConfig()
+	l.Ctx, l.Cancel = context.WithCancel(context.Background())
 }
 
-func (l *LeaderElection) SetWatcher(watcher <-chan zk.Event) {
+func (l *LeaderElection) SetWatcher(watcher <-chan coordination.Event) {
 	l.connectionWatcher = watcher
 }
+
+func (l *LeaderElection) Session() coordination.Session {
+	l.connMu.Lock()
+	defer l.connMu.Unlock()
+	return l.conn
+}
+
+func ListCandidates(session coordination.Session, namespace string) ([]CandidateInfo, error) {
+	return listCandidates(session, namespace)
+}
@@ -2,17 +2,43 @@ package election
 
 import (
 	"fmt"
+	"time"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
 )
 
 func (l *LeaderElection) validateConfig() error {
-	if len(l.Zookeepers) == 0 {
+	err := validateConnection(l.Backend, l.Zookeepers, l.ZkNamespace, l.ZkTimeout, l.TLS)
+	if err != nil {
+		return err
+	}
+	if l.DisconnectPolicy == FenceOnDisconnect && (l.FenceTimeout <= 0 || l.FenceTimeout >= l.ZkTimeout) {
+		return fmt.Errorf("fence timeout must be positive and smaller than the zookeeper timeout")
+	}
+	return nil
+}
+
+func (o *Observer) validateConfig() error {
+	return validateConnection(o.Backend, o.Zookeepers, o.ZkNamespace, o.ZkTimeout, o.TLS)
+}
+
+// validateConnection checks the settings shared by the elections and the observers to reach the coordination store
+func validateConnection(backend coordination.Backend, zookeepers []string, namespace string, timeout time.Duration, tls *utils.TLSConfig) error {
+	if backend == nil && len(zookeepers) == 0 {
 		return fmt.Errorf("no zookeepers provided")
 	}
-	if l.ZkNamespace == "" {
+	if namespace == "" {
 		return fmt.Errorf("no zookeeper namespace provided")
 	}
-	if l.ZkTimeout == 0 {
+	if timeout == 0 {
 		return fmt.Errorf("no zookeeper timeout provided")
 	}
+	if tls != nil {
+		_, err := tls.ClientConfig()
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
@@ -0,0 +1,170 @@
+// Package leadership is the state machine shared by the elections of this module
+// it publishes the state of a node through a read-only API and runs the leadership callbacks, only the elections can move a node from a state to another
+package leadership
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// State is the state of a node in an election, the states are documented in package election
+type State int
+
+const (
+	Disconnected State = iota
+	Candidate
+	Follower
+	Leader
+	Stopped
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case Disconnected:
+		return "Disconnected"
+	case Candidate:
+		return "Candidate"
+	case Follower:
+		return "Follower"
+	case Leader:
+		return "Leader"
+	case Stopped:
+		return "Stopped"
+	default:
+		return "Unknown"
+	}
+}
+
+// ErrStopped is returned by WaitForLeadership when the election loop exits before the node becomes the leader, package election exports it as ErrElectionStopped
+var ErrStopped = errors.New("election stopped")
+
+// Leadership publishes the state of a node, it is embedded by the elections so that they all expose the same API
+// its methods only read the state, the elections move it with Transition. Its zero value is a Disconnected node
+type Leadership struct {
+	// stateMu protects state, stateChanged and fencingToken
+	stateMu sync.Mutex
+	// state is the current state of the node in the election, use State() to read it
+	state State
+	// stateChanged is closed and replaced on every state transition
+	stateChanged chan struct{}
+	// fencingToken is the fencing token of the current leadership term
+	fencingToken int64
+	// leaderCtx is the context handed to OnElected, it lives as long as the current leadership
+	leaderCtx context.Context
+	// leaderCancel cancels leaderCtx when the leadership is lost
+	leaderCancel context.CancelFunc
+}
+
+// State returns the current state of the node. It is safe to call it from any goroutine
+func (l *Leadership) State() State {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	return l.state
+}
+
+// IsLeader indicates if the node is currently the leader. It is safe to call it from any goroutine
+func (l *Leadership) IsLeader() bool {
+	return l.State() == Leader
+}
+
+// FencingToken returns the fencing token of the current leadership term and true if the node is the leader
+// a newer leadership term always has a bigger token than the older ones so it can be handed to storage systems to reject writes from stale leaders
+// with LeaderElection, the token is the creation revision of the candidate znode that won the election, the czxid on zookeeper
+func (l *Leadership) FencingToken() (int64, bool) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	if l.state != Leader {
+		return 0, false
+	}
+	return l.fencingToken, true
+}
+
+// WaitForLeadership blocks until the node becomes the leader
+// it returns ctx.Err() if the context is done first and ErrElectionStopped if the election loop exits first
+func (l *Leadership) WaitForLeadership(ctx context.Context) error {
+	for {
+		state, changed := Changes(l)
+		switch state {
+		case Leader:
+			return nil
+		case Stopped:
+			return ErrStopped
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// fencingTokenKey is the context key under which the fencing token is stored in the context handed to OnElected
+type fencingTokenKey struct{}
+
+// FencingTokenFromContext returns the fencing token of the leadership term the context was created for
+// it only works with the context handed to OnElected
+func FencingTokenFromContext(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(fencingTokenKey{}).(int64)
+	return token, ok
+}
+
+// Changes returns the current state of the node and a channel that is closed on the next state transition
+func Changes(l *Leadership) (State, <-chan struct{}) {
+	l.stateMu.Lock()
+	defer l.stateMu.Unlock()
+	return l.state, l.stateChangedLocked()
+}
+
+// stateChangedLocked returns the channel that will be closed on the next state transition. stateMu must be held
+func (l *Leadership) stateChangedLocked() chan struct{} {
+	if l.stateChanged == nil {
+		l.stateChanged = make(chan struct{})
+	}
+	return l.stateChanged
+}
+
+// LeaderContext returns the context of the current leadership term, it is only meaningful while the node is the leader
+// it must only be called from the election goroutine
+func LeaderContext(l *Leadership) context.Context {
+	return l.leaderCtx
+}
+
+// Transition moves the node to the given state, token is the fencing token of the term when the state is Leader
+// when the leadership is gained, a new leader context is derived from parent and handed to onElected in its own goroutine
+// when the leadership is lost, the leader context is cancelled before the new state is visible and then onRevoked is called
+// it is a function rather than a method so that it is not promoted to the elections that embed Leadership, and must only be called from their election goroutine
+func Transition(l *Leadership, state State, token int64, parent context.Context, log *zerolog.Logger, onElected func(ctx context.Context), onRevoked func()) {
+	previous := l.State()
+	if previous == state {
+		return
+	}
+	if previous == Leader && l.leaderCancel != nil {
+		l.leaderCancel()
+		l.leaderCancel = nil
+	}
+	if state == Leader {
+		if parent == nil {
+			parent = context.Background()
+		}
+		l.leaderCtx, l.leaderCancel = context.WithCancel(context.WithValue(parent, fencingTokenKey{}, token))
+	}
+	l.stateMu.Lock()
+	l.state = state
+	if state == Leader {
+		l.fencingToken = token
+	}
+	close(l.stateChangedLocked())
+	l.stateChanged = nil
+	l.stateMu.Unlock()
+	log.Info().Msgf("State changed from %s to %s", previous, state)
+	if state == Leader && onElected != nil {
+		go onElected(l.leaderCtx)
+	}
+	if previous == Leader && onRevoked != nil {
+		onRevoked()
+	}
+}
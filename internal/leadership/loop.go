@@ -0,0 +1,52 @@
+package leadership
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+// Callbacks are the functions an election calls when the leadership of the node flips
+type Callbacks struct {
+	// OnElected is called when the node becomes the leader. The context passed to it is cancelled as soon as the leadership is lost
+	// It is started in its own goroutine so it is safe to block in it for as long as the context is not done
+	OnElected func(ctx context.Context)
+	// OnRevoked is called when the node loses the leadership. It is called synchronously from the election goroutine so it should return quickly
+	OnRevoked func()
+}
+
+// Loop is what the elections that run their own loop share: the logger, the callbacks, the context of the loop and the published state
+type Loop struct {
+	// Log is logger that will be used. If you don't provide a logger, it will use the default logger
+	Log *zerolog.Logger
+	// Callbacks are called when the leadership of the node flips
+	Callbacks
+	// Cancel is the cancel function for the context of the election loop. You can safely use it to stop the loop
+	Cancel context.CancelFunc
+	// Ctx is the context of the election loop
+	Ctx context.Context
+	// Leadership publishes the state of the node
+	Leadership
+}
+
+// Start derives the context of the election loop from ctx
+// it returns the function the loop defers to stop the node once it exits
+func Start(l *Loop, ctx context.Context) (stop func()) {
+	l.Ctx, l.Cancel = context.WithCancel(ctx)
+	return func() {
+		SetState(l, Stopped)
+		l.Cancel()
+	}
+}
+
+// SetState moves the node to a state other than Leader and calls OnRevoked when the leadership is lost
+// it must only be called from the election goroutine
+func SetState(l *Loop, state State) {
+	Transition(&l.Leadership, state, 0, l.Ctx, l.Log, l.OnElected, l.OnRevoked)
+}
+
+// Lead makes the node the leader of the term with the given fencing token and starts OnElected
+// it must only be called from the election goroutine
+func Lead(l *Loop, token int64) {
+	Transition(&l.Leadership, Leader, token, l.Ctx, l.Log, l.OnElected, l.OnRevoked)
+}
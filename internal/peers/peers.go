@@ -0,0 +1,75 @@
+// Package peers holds what the elections among a static set of peers share, the nodes of these elections talk to each other over a transport.Transport
+package peers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/transport"
+)
+
+// Leader is the leader known by a node. It is safe to use it from any goroutine
+type Leader struct {
+	// mu protects id and known
+	mu    sync.Mutex
+	id    int
+	known bool
+}
+
+// Get returns the identifier of the leader, false if it is not known
+func (l *Leader) Get() (int, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.id, l.known
+}
+
+// Set records the leader
+func (l *Leader) Set(id int, known bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.id, l.known = id, known
+}
+
+// Others returns the peers other than the node itself
+func Others(self int, peers []int) []int {
+	others := make([]int, 0, len(peers))
+	for _, peer := range peers {
+		if peer != self {
+			others = append(others, peer)
+		}
+	}
+	return others
+}
+
+// ResetTimer makes the timer fire after the given duration, a tick that was not read yet is dropped
+// the timer must only be read by the goroutine that resets it
+func ResetTimer(timer *time.Timer, duration time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(duration)
+}
+
+// Send sends a message to the peer in the background, giving up after timeout or when ctx is done
+// the failures are only logged and left to the timeouts of the algorithm
+func Send(ctx context.Context, log *zerolog.Logger, sender transport.Transport, timeout time.Duration, to int, kind string, content interface{}) {
+	msg, err := transport.NewMessage(kind, content)
+	if err != nil {
+		log.Info().Err(err).Msgf("Failed to encode the %s message", kind)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		err := sender.Send(ctx, to, msg)
+		if err != nil {
+			log.Debug().Err(err).Msgf("Failed to send the %s message to node %d", kind, to)
+		}
+	}()
+}
@@ -0,0 +1,117 @@
+// Package peertest runs the nodes of the elections among peers on an in-memory network for the specs of the bully, ring and raft packages
+// its helpers assert with gomega, so they must be called from the specs
+package peertest
+
+import (
+	"context"
+
+	. "github.com/onsi/gomega"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/leadership"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/transport"
+)
+
+// Node is a node of an election among peers
+type Node interface {
+	Run(ctx context.Context) error
+	State() leadership.State
+	Leader() (int, bool)
+}
+
+// Cluster is a set of nodes on an in-memory network
+type Cluster[N Node] struct {
+	// Network is the network of the nodes, it can partition them
+	Network *transport.Network
+	// Nodes are the nodes that joined the network and did not crash
+	Nodes map[int]N
+	// ctx is the context the nodes run with
+	ctx context.Context
+	// newNode builds a node on its transport
+	newNode func(memory transport.Transport) N
+	// transports are the transports of the nodes
+	transports map[int]*transport.Memory
+	// runs receive what Run returned, for the nodes that were started
+	runs map[int]chan error
+}
+
+// NewCluster returns a cluster without nodes, newNode builds the nodes that join it and they run with ctx
+func NewCluster[N Node](ctx context.Context, newNode func(memory transport.Transport) N) *Cluster[N] {
+	return &Cluster[N]{
+		Network:    transport.NewNetwork(),
+		Nodes:      map[int]N{},
+		ctx:        ctx,
+		newNode:    newNode,
+		transports: map[int]*transport.Memory{},
+		runs:       map[int]chan error{},
+	}
+}
+
+// Join attaches new nodes to the network without running them, so that the specs can configure them first
+func (c *Cluster[N]) Join(ids ...int) {
+	for _, id := range ids {
+		memory, err := c.Network.Join(id)
+		Expect(err).To(BeNil())
+		c.Nodes[id], c.transports[id] = c.newNode(memory), memory
+	}
+}
+
+// Run runs nodes that joined the network
+func (c *Cluster[N]) Run(ids ...int) {
+	for _, id := range ids {
+		node, done := c.Nodes[id], make(chan error, 1)
+		go func() {
+			done <- node.Run(c.ctx)
+		}()
+		c.runs[id] = done
+	}
+}
+
+// Start attaches new nodes to the network and runs them
+func (c *Cluster[N]) Start(ids ...int) {
+	c.Join(ids...)
+	c.Run(ids...)
+}
+
+// Crash closes the transport of the node, as if its process died, and removes it from the cluster once it stopped
+func (c *Cluster[N]) Crash(id int) {
+	c.transports[id].Close()
+	Eventually(c.runs[id]).Should(Receive(MatchError(transport.ErrClosed)))
+	Expect(c.Nodes[id].State()).To(Equal(leadership.Stopped))
+	delete(c.Nodes, id)
+	delete(c.transports, id)
+	delete(c.runs, id)
+}
+
+// ExpectLeader waits for every node of the cluster to agree on the leader, and for the leader to lead and the others to follow
+func (c *Cluster[N]) ExpectLeader(leader int) {
+	for id, node := range c.Nodes {
+		Eventually(LeaderOf(node)).Should(Equal(leader))
+		if id == leader {
+			Eventually(node.State).Should(Equal(leadership.Leader))
+		} else {
+			Eventually(node.State).Should(Equal(leadership.Follower))
+		}
+	}
+}
+
+// Close waits for the nodes that were started to stop and closes the transports, the context of the nodes must be done
+func (c *Cluster[N]) Close() {
+	for id, done := range c.runs {
+		Eventually(done).Should(Receive())
+		Expect(c.Nodes[id].State()).To(Equal(leadership.Stopped))
+	}
+	for _, memory := range c.transports {
+		memory.Close()
+	}
+}
+
+// LeaderOf returns a function that returns the leader known by the node, -1 if it does not know it
+func LeaderOf(node Node) func() int {
+	return func() int {
+		leader, ok := node.Leader()
+		if !ok {
+			return -1
+		}
+		return leader
+	}
+}
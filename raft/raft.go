@@ -0,0 +1,402 @@
+// Package raft elects a leader among a static set of peers with the leader election and heartbeats of the Raft consensus algorithm
+// there is no log to replicate: a leader is elected by a majority of the peers in a term, and a term has at most one leader
+// it needs no coordination service, the nodes talk to each other over a transport.Transport
+package raft
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/leadership"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/peers"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/transport"
+)
+
+const (
+	// DefaultElectionTimeout is the election timeout used when ElectionTimeout is not set
+	DefaultElectionTimeout = time.Second
+	// DefaultHeartbeatInterval is the heartbeat interval used when HeartbeatInterval is not set
+	DefaultHeartbeatInterval = 100 * time.Millisecond
+)
+
+// the kinds of the messages of the algorithm
+const (
+	// requestVoteMessage asks a peer for its vote, or for its pre-vote
+	requestVoteMessage = "request-vote"
+	// voteMessage is the answer to a request vote message
+	voteMessage = "vote"
+	// appendEntriesMessage is the heartbeat of the leader, there are no entries to append
+	appendEntriesMessage = "append-entries"
+	// appendResponseMessage acknowledges a heartbeat of the leader
+	appendResponseMessage = "append-response"
+)
+
+// payload is the content of every message
+type payload struct {
+	// Term is the term of the sender, or the term a pre-candidate would start
+	Term int64 `json:"term"`
+	// PreVote tells that a request vote or vote message belongs to a pre-vote
+	PreVote bool `json:"preVote,omitempty"`
+	// Granted tells that the vote is granted or the heartbeat accepted
+	Granted bool `json:"granted,omitempty"`
+}
+
+// phase is the role of the node in the algorithm
+type phase int
+
+const (
+	// following means the node follows the leader of the term, if any
+	following phase = iota
+	// preCampaigning means the node asks its peers if they would vote for it before starting a new term
+	preCampaigning
+	// campaigning means the node started a new term and asks its peers for their votes
+	campaigning
+	// leading means the node was elected by a majority in the current term
+	leading
+)
+
+// Node is a node of a Raft election
+// It publishes the same states and runs the same callbacks as election.LeaderElection, the fencing token is the term of the leader
+// The term and the vote of the node are kept in memory: a node that restarts must wait for an election timeout before it runs again so that it does not vote twice in a term
+type Node struct {
+	// Transport carries the messages of the node, its identifier is the identifier of the node
+	Transport transport.Transport
+	// Peers are the identifiers of the other nodes, the node itself is ignored if it is listed
+	// a leader needs the votes of a majority of the peers and the node
+	Peers []int
+	// ElectionTimeout is how long a follower waits for a heartbeat before starting an election, it is randomized between ElectionTimeout and twice ElectionTimeout
+	// a leader that has not heard from a majority for ElectionTimeout steps down. The default value is DefaultElectionTimeout
+	ElectionTimeout time.Duration
+	// HeartbeatInterval is the time between two heartbeats of the leader
+	// It must be smaller than ElectionTimeout. The default value is DefaultHeartbeatInterval
+	HeartbeatInterval time.Duration
+	// PreVote makes a node ask its peers if they would vote for it before it starts a new term
+	// a node that is cut from the others then never increases its term, so it does not depose the leader when it comes back
+	PreVote bool
+	// Loop holds the logger, the callbacks, the context of the election loop and the published state
+	election.Loop
+	// termMu protects term
+	termMu sync.Mutex
+	// term is the current term of the node
+	term int64
+	// leader is the leader of the current term
+	leader peers.Leader
+	// votedFor is the node the node voted for in the current term
+	votedFor int
+	hasVoted bool
+	// lastHeartbeat is the last time the node heard from the leader of the current term
+	lastHeartbeat time.Time
+	// votes are the peers that granted their vote, or pre-vote, to the node
+	votes map[int]bool
+	// acks is the last time every peer acknowledged a heartbeat of the leader
+	acks map[int]time.Time
+	// phase is the role of the node in the algorithm
+	phase phase
+	// timer fires at the election timeout, or at the next heartbeat of a leader
+	timer *time.Timer
+}
+
+// defaultConfig initializes the recommended default values for the node
+func (n *Node) defaultConfig() {
+	if n.ElectionTimeout == 0 {
+		n.ElectionTimeout = DefaultElectionTimeout
+	}
+	if n.HeartbeatInterval == 0 {
+		n.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if n.Log == nil {
+		n.Log = &log.Logger
+	}
+}
+
+func (n *Node) validateConfig() error {
+	if n.Transport == nil {
+		return fmt.Errorf("no transport provided")
+	}
+	if n.HeartbeatInterval <= 0 || n.ElectionTimeout <= n.HeartbeatInterval {
+		return fmt.Errorf("timeouts must verify 0 < heartbeat interval < election timeout")
+	}
+	return nil
+}
+
+// ID returns the identifier of the node
+func (n *Node) ID() int {
+	return n.Transport.ID()
+}
+
+// Leader returns the identifier of the leader of the current term, false if the node does not know it
+func (n *Node) Leader() (int, bool) {
+	return n.leader.Get()
+}
+
+// Term returns the current term of the node. It is safe to call it from any goroutine
+func (n *Node) Term() int64 {
+	n.termMu.Lock()
+	defer n.termMu.Unlock()
+	return n.term
+}
+
+// setTerm moves the node to the given term, the leader of the new term is not known yet
+func (n *Node) setTerm(term int64) {
+	n.termMu.Lock()
+	n.term = term
+	n.termMu.Unlock()
+	n.leader.Set(0, false)
+	n.hasVoted = false
+}
+
+// Run takes part in the election until ctx is done or the transport is closed
+// it blocks the calling goroutine and returns an error when the configuration is invalid or the transport is closed
+func (n *Node) Run(ctx context.Context) error {
+	n.defaultConfig()
+	err := n.validateConfig()
+	if err != nil {
+		return err
+	}
+	defer leadership.Start(&n.Loop, ctx)()
+	defer n.leader.Set(0, false)
+	n.timer = time.NewTimer(n.ElectionTimeout)
+	defer n.timer.Stop()
+	n.follow(n.Term())
+	for {
+		select {
+		case <-n.Ctx.Done():
+			n.Log.Info().Msg("Context cancelled. Exiting")
+			return nil
+		case msg, ok := <-n.Transport.Messages():
+			if !ok {
+				n.Log.Info().Msg("Transport closed. Exiting")
+				return transport.ErrClosed
+			}
+			n.handle(msg)
+		case <-n.timer.C:
+			n.timeout()
+		}
+	}
+}
+
+// resetElectionTimer makes the timer fire after a random election timeout, so that the nodes rarely campaign at the same time
+func (n *Node) resetElectionTimer() {
+	peers.ResetTimer(n.timer, n.ElectionTimeout+time.Duration(rand.Int63n(int64(n.ElectionTimeout))))
+}
+
+// majority is the number of votes needed to win an election
+func (n *Node) majority() int {
+	return (len(peers.Others(n.ID(), n.Peers))+1)/2 + 1
+}
+
+// heardFromLeader tells if the node is the leader or has heard from the leader within the election timeout
+// such a node refuses to vote, so that a node that was cut from the others cannot depose a leader that is alive
+func (n *Node) heardFromLeader() bool {
+	if n.phase == leading {
+		return true
+	}
+	_, known := n.Leader()
+	return known && time.Since(n.lastHeartbeat) < n.ElectionTimeout
+}
+
+// follow makes the node a follower in the given term
+func (n *Node) follow(term int64) {
+	if term > n.Term() {
+		n.setTerm(term)
+	}
+	n.phase = following
+	leadership.SetState(&n.Loop, election.Follower)
+	n.resetElectionTimer()
+}
+
+// timeout starts an election when the leader went silent, or sends the heartbeats of a leader
+func (n *Node) timeout() {
+	if n.phase == leading {
+		if !n.hasQuorum() {
+			n.Log.Info().Msg("Lost contact with the majority, stepping down")
+			n.leader.Set(0, false)
+			n.follow(n.Term())
+			return
+		}
+		n.broadcast(appendEntriesMessage, payload{Term: n.Term()})
+		peers.ResetTimer(n.timer, n.HeartbeatInterval)
+		return
+	}
+	n.leader.Set(0, false)
+	if n.PreVote {
+		n.preCampaign()
+		return
+	}
+	n.campaign()
+}
+
+// preCampaign asks the peers if they would vote for the node in the next term, without starting it
+func (n *Node) preCampaign() {
+	n.Log.Info().Msgf("Starting a pre-vote for term %d", n.Term()+1)
+	n.phase = preCampaigning
+	leadership.SetState(&n.Loop, election.Candidate)
+	n.votes = map[int]bool{n.ID(): true}
+	n.broadcast(requestVoteMessage, payload{Term: n.Term() + 1, PreVote: true})
+	n.resetElectionTimer()
+	n.countVotes()
+}
+
+// campaign starts a new term, votes for the node and asks the peers for their votes
+func (n *Node) campaign() {
+	n.setTerm(n.Term() + 1)
+	n.Log.Info().Msgf("Starting an election for term %d", n.Term())
+	n.phase = campaigning
+	leadership.SetState(&n.Loop, election.Candidate)
+	n.votedFor, n.hasVoted = n.ID(), true
+	n.votes = map[int]bool{n.ID(): true}
+	n.broadcast(requestVoteMessage, payload{Term: n.Term()})
+	n.resetElectionTimer()
+	n.countVotes()
+}
+
+// countVotes moves the node forward once a majority granted its vote
+func (n *Node) countVotes() {
+	if len(n.votes) < n.majority() {
+		return
+	}
+	switch n.phase {
+	case preCampaigning:
+		n.campaign()
+	case campaigning:
+		n.lead()
+	}
+}
+
+// lead makes the node the leader of the current term and sends the first heartbeats
+func (n *Node) lead() {
+	n.Log.Info().Msgf("Elected for term %d", n.Term())
+	n.phase = leading
+	n.leader.Set(n.ID(), true)
+	n.acks = map[int]time.Time{}
+	now := time.Now()
+	for _, peer := range peers.Others(n.ID(), n.Peers) {
+		n.acks[peer] = now
+	}
+	leadership.Lead(&n.Loop, n.Term())
+	n.broadcast(appendEntriesMessage, payload{Term: n.Term()})
+	peers.ResetTimer(n.timer, n.HeartbeatInterval)
+}
+
+// hasQuorum tells if a majority acknowledged a heartbeat of the leader within the election timeout
+func (n *Node) hasQuorum() bool {
+	alive := 1
+	for _, ack := range n.acks {
+		if time.Since(ack) < n.ElectionTimeout {
+			alive++
+		}
+	}
+	return alive >= n.majority()
+}
+
+// handle processes a message from a peer
+func (n *Node) handle(msg transport.Message) {
+	var content payload
+	err := msg.Decode(&content)
+	if err != nil {
+		n.Log.Info().Err(err).Msgf("Ignoring invalid %s message from node %d", msg.Kind, msg.From)
+		return
+	}
+	switch msg.Kind {
+	case requestVoteMessage:
+		n.handleRequestVote(msg.From, content)
+	case voteMessage:
+		n.handleVote(msg.From, content)
+	case appendEntriesMessage:
+		n.handleAppendEntries(msg.From, content)
+	case appendResponseMessage:
+		n.handleAppendResponse(msg.From, content)
+	}
+}
+
+// handleRequestVote grants the vote, or the pre-vote, of the node to a candidate
+func (n *Node) handleRequestVote(from int, content payload) {
+	if n.heardFromLeader() {
+		n.send(from, voteMessage, payload{Term: n.Term(), PreVote: content.PreVote})
+		return
+	}
+	if content.PreVote {
+		// a pre-vote does not change the term or the vote of the node
+		granted := content.Term > n.Term()
+		term := n.Term()
+		if granted {
+			term = content.Term
+		}
+		n.send(from, voteMessage, payload{Term: term, PreVote: true, Granted: granted})
+		return
+	}
+	if content.Term > n.Term() {
+		n.follow(content.Term)
+	}
+	granted := content.Term == n.Term() && (!n.hasVoted || n.votedFor == from)
+	if granted {
+		n.votedFor, n.hasVoted = from, true
+		n.resetElectionTimer()
+	}
+	n.send(from, voteMessage, payload{Term: n.Term(), Granted: granted})
+}
+
+// handleVote counts the vote, or the pre-vote, of a peer
+func (n *Node) handleVote(from int, content payload) {
+	if content.Term > n.Term() && !(content.PreVote && content.Granted) {
+		n.follow(content.Term)
+		return
+	}
+	if !content.Granted {
+		return
+	}
+	switch {
+	case content.PreVote && n.phase == preCampaigning && content.Term == n.Term()+1:
+	case !content.PreVote && n.phase == campaigning && content.Term == n.Term():
+	default:
+		return
+	}
+	n.votes[from] = true
+	n.countVotes()
+}
+
+// handleAppendEntries follows the leader of the heartbeat unless it belongs to an older term
+func (n *Node) handleAppendEntries(from int, content payload) {
+	if content.Term < n.Term() {
+		n.send(from, appendResponseMessage, payload{Term: n.Term()})
+		return
+	}
+	if leader, known := n.Leader(); !known || leader != from {
+		n.Log.Info().Msgf("Following node %d in term %d", from, content.Term)
+	}
+	n.follow(content.Term)
+	n.leader.Set(from, true)
+	n.lastHeartbeat = time.Now()
+	n.send(from, appendResponseMessage, payload{Term: n.Term(), Granted: true})
+}
+
+// handleAppendResponse records the acknowledgement of a heartbeat, the leader steps down if a peer is in a newer term
+func (n *Node) handleAppendResponse(from int, content payload) {
+	if content.Term > n.Term() {
+		n.Log.Info().Msgf("Node %d is in the newer term %d, stepping down", from, content.Term)
+		n.leader.Set(0, false)
+		n.follow(content.Term)
+		return
+	}
+	if n.phase == leading && content.Granted && content.Term == n.Term() {
+		n.acks[from] = time.Now()
+	}
+}
+
+// send sends a message to the peer in the background, the failures are left to the timeouts of the algorithm
+func (n *Node) send(to int, kind string, content payload) {
+	peers.Send(n.Ctx, n.Log, n.Transport, n.HeartbeatInterval, to, kind, content)
+}
+
+// broadcast sends a message to every peer
+func (n *Node) broadcast(kind string, content payload) {
+	for _, peer := range peers.Others(n.ID(), n.Peers) {
+		n.send(peer, kind, content)
+	}
+}
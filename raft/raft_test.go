@@ -0,0 +1,192 @@
+package raft_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/peertest"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/raft"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/transport"
+)
+
+var _ = Describe("Raft election on an in-memory network", func() {
+	var (
+		ctx     context.Context
+		cancel  context.CancelFunc
+		cluster *peertest.Cluster[*raft.Node]
+		preVote bool
+	)
+
+	// start runs the nodes with the given identifiers, every node knows the others
+	start := func(ids ...int) {
+		cluster.Join(ids...)
+		for _, id := range ids {
+			cluster.Nodes[id].Peers = ids
+		}
+		cluster.Run(ids...)
+	}
+	// leaders returns a function that returns the nodes among the given ones that are leaders
+	leaders := func(ids ...int) func() []int {
+		return func() []int {
+			var leaders []int
+			for _, id := range ids {
+				if cluster.Nodes[id].IsLeader() {
+					leaders = append(leaders, id)
+				}
+			}
+			return leaders
+		}
+	}
+	// expectLeader waits for the given nodes to agree on a single leader and returns it
+	expectLeader := func(ids ...int) int {
+		Eventually(leaders(ids...), 5*time.Second).Should(HaveLen(1))
+		leader := leaders(ids...)()[0]
+		for _, id := range ids {
+			Eventually(peertest.LeaderOf(cluster.Nodes[id])).Should(Equal(leader))
+		}
+		return leader
+	}
+
+	BeforeEach(func() {
+		preVote = true
+		ctx, cancel = context.WithCancel(context.Background())
+		cluster = peertest.NewCluster(ctx, func(memory transport.Transport) *raft.Node {
+			return &raft.Node{
+				Transport:         memory,
+				ElectionTimeout:   150 * time.Millisecond,
+				HeartbeatInterval: 30 * time.Millisecond,
+				PreVote:           preVote,
+			}
+		})
+	})
+	AfterEach(func() {
+		cancel()
+		cluster.Close()
+	})
+
+	It("must elect a single leader whose fencing token is its term", func() {
+		start(1, 2, 3, 4, 5)
+		leader := expectLeader(1, 2, 3, 4, 5)
+		token, ok := cluster.Nodes[leader].FencingToken()
+		Expect(ok).To(BeTrue())
+		Expect(token).To(Equal(cluster.Nodes[leader].Term()))
+		Consistently(leaders(1, 2, 3, 4, 5), 500*time.Millisecond).Should(Equal([]int{leader}))
+		for id, node := range cluster.Nodes {
+			if id != leader {
+				Expect(node.State()).To(Equal(election.Follower))
+				Expect(node.Term()).To(Equal(token))
+			}
+		}
+	})
+
+	It("must elect a new leader in a bigger term when the leader crashes", func() {
+		start(1, 2, 3)
+		leader := expectLeader(1, 2, 3)
+		firstToken, _ := cluster.Nodes[leader].FencingToken()
+		cluster.Crash(leader)
+		var others []int
+		for id := range cluster.Nodes {
+			others = append(others, id)
+		}
+		next := expectLeader(others...)
+		secondToken, ok := cluster.Nodes[next].FencingToken()
+		Expect(ok).To(BeTrue())
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+	})
+
+	It("must not elect a leader without a majority", func() {
+		start(1, 2, 3)
+		leader := expectLeader(1, 2, 3)
+		var others []int
+		for id := range cluster.Nodes {
+			if id != leader {
+				others = append(others, id)
+			}
+		}
+		cluster.Crash(others[0])
+		cluster.Crash(others[1])
+		// the leader steps down once it cannot reach a majority anymore
+		Eventually(cluster.Nodes[leader].IsLeader).Should(BeFalse())
+		Consistently(cluster.Nodes[leader].IsLeader, 500*time.Millisecond).Should(BeFalse())
+	})
+
+	It("must move the leadership to the majority side of a partition and back once it heals", func() {
+		start(1, 2, 3, 4, 5)
+		leader := expectLeader(1, 2, 3, 4, 5)
+		firstToken, _ := cluster.Nodes[leader].FencingToken()
+		var majority []int
+		for id := range cluster.Nodes {
+			if id != leader && len(majority) < 3 {
+				majority = append(majority, id)
+			}
+		}
+		cluster.Network.Partition(majority)
+		next := expectLeader(majority...)
+		secondToken, _ := cluster.Nodes[next].FencingToken()
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+		// the former leader steps down on its own since it cannot reach a majority
+		Eventually(cluster.Nodes[leader].IsLeader).Should(BeFalse())
+		cluster.Network.Heal()
+		expectLeader(1, 2, 3, 4, 5)
+	})
+
+	Describe("Pre-vote", func() {
+		// isolate partitions a follower away and waits for a few election timeouts
+		// it returns the follower, the leader and the term before the partition
+		isolate := func() (int, int, int64) {
+			start(1, 2, 3)
+			leader := expectLeader(1, 2, 3)
+			term := cluster.Nodes[leader].Term()
+			follower := 1
+			if leader == 1 {
+				follower = 2
+			}
+			cluster.Network.Partition([]int{follower})
+			Eventually(cluster.Nodes[follower].State).Should(Equal(election.Candidate))
+			time.Sleep(time.Second)
+			return follower, leader, term
+		}
+
+		It("must keep the term of an isolated node so that it does not depose the leader when it comes back", func() {
+			follower, leader, term := isolate()
+			Expect(cluster.Nodes[follower].Term()).To(Equal(term))
+			cluster.Network.Heal()
+			Eventually(peertest.LeaderOf(cluster.Nodes[follower])).Should(Equal(leader))
+			Consistently(cluster.Nodes[leader].IsLeader, 500*time.Millisecond).Should(BeTrue())
+			Expect(cluster.Nodes[leader].Term()).To(Equal(term))
+		})
+
+		It("must let an isolated node depose the leader with a bigger term without it", func() {
+			preVote = false
+			follower, _, term := isolate()
+			Expect(cluster.Nodes[follower].Term()).To(BeNumerically(">", term))
+			cluster.Network.Heal()
+			Eventually(func() int64 {
+				elected := leaders(1, 2, 3)()
+				if len(elected) != 1 {
+					return 0
+				}
+				return cluster.Nodes[elected[0]].Term()
+			}, 5*time.Second).Should(BeNumerically(">", term))
+		})
+	})
+
+	It("must become the leader on its own when it has no peers", func() {
+		start(1)
+		Expect(cluster.Nodes[1].WaitForLeadership(ctx)).To(Succeed())
+		token, _ := cluster.Nodes[1].FencingToken()
+		Expect(token).To(Equal(int64(1)))
+	})
+
+	It("must refuse an invalid configuration", func() {
+		cluster.Join(1)
+		node := cluster.Nodes[1]
+		node.ElectionTimeout, node.HeartbeatInterval = time.Second, time.Second
+		Expect(node.Run(ctx)).NotTo(Succeed())
+		Expect((&raft.Node{}).Run(ctx)).NotTo(Succeed())
+	})
+})
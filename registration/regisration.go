@@ -1,10 +1,12 @@
 package registration
 
 import (
+	"context"
 	"fmt"
 	"time"
 
-	"github.com/go-zookeeper/zk"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/zookeeper"
 	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
 )
 
@@ -14,62 +16,122 @@ var (
 	connectionTimeout = time.Second * 5
 )
 
-func register() {
+// Registration registers the running instance as an ephemeral znode named after the hostname
+type Registration struct {
+	// Zookeepers is a list of zookeeper servers. It is not needed when Backend is set
+	Zookeepers []string
+	// Backend is the coordination store the instance is registered in
+	// The default value is a zookeeper backend built from Zookeepers and TLS
+	Backend coordination.Backend
+	// Path is the parent znode of the instances. It must exist
+	Path string
+	// TLS is the configuration used to encrypt the connection to zookeeper. If it is not provided, the connection is plain TCP
+	TLS *utils.TLSConfig
+	// RenewInterval is how often the data of the znode is refreshed to keep the session alive. The default value is 2 seconds
+	RenewInterval time.Duration
+	// RetryInterval is how long to wait before registering again after the registration was lost. The default value is 5 seconds
+	RetryInterval time.Duration
+}
+
+// Register registers the instance and keeps the registration alive, it only returns if another instance is registered with the same hostname
+func (r *Registration) Register() {
+	err := r.Run(context.Background())
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+// Run registers the instance and keeps the registration alive until ctx is done
+// the instance registers again when its znode is deleted, its session expires or is closed, or its credentials are refused
+// it returns an error wrapping coordination.ErrNodeExists if another instance is registered with the same hostname
+func (r *Registration) Run(ctx context.Context) error {
 	dataS, err := utils.GetHostname()
 	if err != nil {
-		return
+		return err
+	}
+	backend := r.Backend
+	if backend == nil {
+		backend = zookeeper.New(zookeeper.Config{Servers: r.Zookeepers, SessionTimeout: connectionTimeout, TLS: r.TLS})
 	}
-	data := []byte(dataS)
-	retryTicker := time.NewTicker(connectionRetry)
-	for range retryTicker.C {
-		// Connect to the ZooKeeper ensemble
-		conn, _, err := zk.Connect([]string{"zk1:2181", "zk2:2181", "zk3:2181"}, connectionTimeout)
-		if err != nil {
-			fmt.Println(err)
-			continue
+	retryInterval := r.RetryInterval
+	if retryInterval == 0 {
+		retryInterval = connectionRetry
+	}
+	path := r.Path + "/" + dataS
+	for {
+		err = r.register(ctx, backend, path, []byte(dataS))
+		if err == coordination.ErrNodeExists {
+			return fmt.Errorf("another instance of the server is running at %s: %w", path, err)
 		}
-
-		// Create an ephemeral node to represent the server
-		path := "/myapp/instances/" + dataS
-		_, err = conn.Create(path, data, zk.FlagEphemeral, zk.WorldACL(zk.PermAll))
-		if err != nil {
-			if err == zk.ErrNodeExists {
-				fmt.Println("Another instance of the server is running")
-				// take appropriate action
-				return
-			}
-			fmt.Println(err)
-			continue
+		if err == nil {
+			return nil
 		}
+		fmt.Println(err)
+		// The session has been closed after an expiry, timeout, network failure or authentication failure
+		fmt.Println("Session expired, closed or authentication failed, re-registering the server")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryInterval):
+		}
+	}
+}
 
-		fmt.Println("Server registered with ZooKeeper at path and data", path, dataS)
+// register creates the znode of the instance and refreshes it until ctx is done or the registration is lost
+// it returns nil when ctx is done and the reason the instance has to register again otherwise
+func (r *Registration) register(ctx context.Context, backend coordination.Backend, path string, data []byte) error {
+	// Connect to the ZooKeeper ensemble
+	conn, err := backend.Connect()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 
-		// Refresh the node's data to keep the session alive
-		leaseTicker := time.NewTicker(leaseRenewal)
-		for range leaseTicker.C {
-			_, err = conn.Set(path, data, -1)
-			if err != nil {
-				fmt.Println(err)
-				if err == zk.ErrNoNode {
-					fmt.Println("Node does not exist, re-registering the server")
-					conn.Close()
-					break
-				}
-				if err == zk.ErrConnectionClosed {
-					fmt.Println("Lost connection to the ensemble, re-connecting")
-					conn.Close()
-					break
-				}
+	// Create an ephemeral node to represent the server
+	_, err = conn.Create(path, data, coordination.Ephemeral)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Server registered with ZooKeeper at path and data", path, string(data))
+
+	renewInterval := r.RenewInterval
+	if renewInterval == 0 {
+		renewInterval = leaseRenewal
+	}
+	// Refresh the node's data to keep the session alive
+	leaseTicker := time.NewTicker(renewInterval)
+	defer leaseTicker.Stop()
+	events := conn.Events()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			// Monitor the session for expiry and authentication failures
+			if !ok {
+				return coordination.ErrClosed
+			}
+			switch event.State {
+			case coordination.StateExpired:
+				return coordination.ErrSessionExpired
+			case coordination.StateAuthFailed:
+				return coordination.ErrAuthFailed
+			}
+		case <-leaseTicker.C:
+			_, err = conn.Set(path, data)
+			switch err {
+			case nil:
+			case coordination.ErrNoNode:
+				fmt.Println("Node does not exist, re-registering the server")
+				return err
+			case coordination.ErrClosed, coordination.ErrSessionExpired, coordination.ErrAuthFailed:
+				fmt.Println("Lost connection to the ensemble, re-connecting")
+				return err
+			default:
 				// handle other errors
+				fmt.Println(err)
 			}
 		}
-
-		// Monitor the session for expiry, timeout or network failures
-		event := conn.State()
-		if event == zk.StateExpired || event == zk.StateDisconnected || event == zk.StateAuthFailed {
-			fmt.Println("Session expired, closed or authentication failed, re-registering the server")
-			conn.Close()
-			continue
-		}
 	}
 }
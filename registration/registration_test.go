@@ -0,0 +1,132 @@
+package registration_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/coordination/memory"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/registration"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/utils"
+)
+
+var _ = Describe("Registration on the in-memory backend", func() {
+	var (
+		store    *memory.Store
+		admin    coordination.Session
+		ctx      context.Context
+		cancel   context.CancelFunc
+		path     string
+		returned chan error
+		stopped  chan struct{}
+	)
+
+	// start runs a registration in the background
+	start := func() {
+		r := &registration.Registration{
+			Backend:       store,
+			Path:          "/instances",
+			RenewInterval: 20 * time.Millisecond,
+			RetryInterval: 20 * time.Millisecond,
+		}
+		ctx, returned, stopped := ctx, returned, stopped
+		go func() {
+			defer close(stopped)
+			returned <- r.Run(ctx)
+		}()
+	}
+	// registered tells if the znode of the instance exists
+	registered := func() bool {
+		exists, _, err := admin.Exists(path)
+		Expect(err).To(BeNil())
+		return exists
+	}
+	// registrationSession returns the session of the registration, the admin session is the first one
+	registrationSession := func() *memory.Session {
+		sessions := store.Sessions()
+		Expect(sessions).To(HaveLen(2))
+		return sessions[1]
+	}
+
+	BeforeEach(func() {
+		var err error
+		store = memory.New()
+		admin, err = store.Connect()
+		Expect(err).To(BeNil())
+		_, err = admin.Create("/instances", []byte{}, coordination.Persistent)
+		Expect(err).To(BeNil())
+		hostname, err := utils.GetHostname()
+		Expect(err).To(BeNil())
+		path = "/instances/" + hostname
+		returned, stopped = make(chan error, 1), make(chan struct{})
+		ctx, cancel = context.WithCancel(context.Background())
+	})
+	AfterEach(func() {
+		cancel()
+		Eventually(stopped).Should(BeClosed())
+		admin.Close()
+	})
+
+	It("must register the instance under its hostname until the context is done", func() {
+		start()
+		Eventually(registered).Should(BeTrue())
+		data, _, err := admin.Get(path)
+		Expect(err).To(BeNil())
+		Expect(path).To(HaveSuffix("/" + string(data)))
+		cancel()
+		Eventually(returned).Should(Receive(BeNil()))
+		Expect(registered()).To(BeFalse())
+		Expect(store.Sessions()).To(HaveLen(1))
+	})
+
+	It("must register again when the znode is deleted", func() {
+		start()
+		Eventually(registered).Should(BeTrue())
+		first := registrationSession()
+		Expect(admin.Delete(path)).To(Succeed())
+		Eventually(registered).Should(BeTrue())
+		Expect(registrationSession()).NotTo(BeIdenticalTo(first))
+	})
+
+	It("must register again when the session expires", func() {
+		start()
+		Eventually(registered).Should(BeTrue())
+		first := registrationSession()
+		first.Expire()
+		Expect(registered()).To(BeFalse())
+		Eventually(registered).Should(BeTrue())
+		Expect(registrationSession()).NotTo(BeIdenticalTo(first))
+	})
+
+	It("must register again when the connection is lost", func() {
+		start()
+		Eventually(registered).Should(BeTrue())
+		first := registrationSession()
+		first.Disconnect()
+		Eventually(func() *memory.Session {
+			return store.Sessions()[len(store.Sessions())-1]
+		}).ShouldNot(BeIdenticalTo(first))
+		Eventually(registered).Should(BeTrue())
+	})
+
+	It("must register again when the credentials are refused", func() {
+		start()
+		Eventually(registered).Should(BeTrue())
+		first := registrationSession()
+		first.FailAuth()
+		Eventually(func() *memory.Session {
+			return store.Sessions()[len(store.Sessions())-1]
+		}).ShouldNot(BeIdenticalTo(first))
+		Eventually(registered).Should(BeTrue())
+	})
+
+	It("must give up when another instance is registered with the same hostname", func() {
+		_, err := admin.Create(path, []byte{}, coordination.Ephemeral)
+		Expect(err).To(BeNil())
+		start()
+		Eventually(returned).Should(Receive(MatchError(coordination.ErrNodeExists)))
+	})
+})
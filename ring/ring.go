@@ -0,0 +1,369 @@
+// Package ring elects the node with the highest identifier of a logical ring with the Chang–Roberts algorithm
+// the messages only travel from a node to its successor, a successor that cannot be reached is skipped so the ring repairs itself when a member fails
+package ring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/leadership"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/peers"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/transport"
+)
+
+const (
+	// DefaultHeartbeatInterval is the heartbeat interval used when HeartbeatInterval is not set
+	DefaultHeartbeatInterval = time.Second
+	// DefaultLeaderTimeout is the leader timeout used when LeaderTimeout is not set
+	DefaultLeaderTimeout = 3 * time.Second
+	// DefaultSendTimeout is the send timeout used when SendTimeout is not set
+	DefaultSendTimeout = 500 * time.Millisecond
+)
+
+// the kinds of the messages of the algorithm
+const (
+	// electionMessage carries the highest candidate seen so far around the ring
+	electionMessage = "election"
+	// electedMessage announces the leader around the ring, the leader sends it again on every heartbeat
+	electedMessage = "elected"
+)
+
+// payload is the content of every message
+type payload struct {
+	// Candidate is the candidate of an election message or the leader of an elected message
+	Candidate int `json:"candidate"`
+	// Term is the highest term known by the sender
+	Term int64 `json:"term"`
+	// Hops is the number of nodes the message went through, a message that went around the ring without being stopped is dropped
+	Hops int `json:"hops"`
+}
+
+// Stats are the numbers of messages a node delivered to its successors
+type Stats struct {
+	// ElectionMessages is the number of election messages
+	ElectionMessages int64
+	// ElectedMessages is the number of elected messages, heartbeats included
+	ElectedMessages int64
+}
+
+// Node is a node of a ring election
+// It publishes the same states and runs the same callbacks as election.LeaderElection
+type Node struct {
+	// Transport carries the messages of the node, its identifier is the identifier of the node
+	Transport transport.Transport
+	// Ring are the identifiers of the nodes in the order of the ring, it must contain the node itself
+	// every node must be given the same ring, the messages go from a node to the next one and from the last one to the first one
+	Ring []int
+	// HeartbeatInterval is the time between two announcements of the leader
+	// It must be smaller than LeaderTimeout. The default value is DefaultHeartbeatInterval
+	HeartbeatInterval time.Duration
+	// LeaderTimeout is how long a node waits for an announcement of the leader before starting an election
+	// The default value is DefaultLeaderTimeout
+	LeaderTimeout time.Duration
+	// SendTimeout is how long the node tries to deliver a message to its successor before skipping it
+	// The default value is DefaultSendTimeout
+	SendTimeout time.Duration
+	// Loop holds the logger, the callbacks, the context of the election loop and the published state
+	election.Loop
+	// leader is the leader known by the node
+	leader peers.Leader
+	// electionMessages and electedMessages count the messages delivered to the successors
+	electionMessages atomic.Int64
+	electedMessages  atomic.Int64
+	// term is the highest term known by the node, the fencing token of a leader is the term it was elected in
+	term int64
+	// participant is set once the node has sent an election message, it then swallows the election messages of lower candidates
+	participant bool
+	// timer fires when the leader timed out, or when the leader has to announce itself again
+	timer *time.Timer
+	// outboxMu protects outbox
+	outboxMu sync.Mutex
+	// outbox holds the messages that have not been delivered to the successor yet, they are delivered in order like the links of the algorithm require
+	outbox []transport.Message
+	// pending is signalled when messages are added to the outbox
+	pending chan struct{}
+}
+
+// defaultConfig initializes the recommended default values for the node
+func (n *Node) defaultConfig() {
+	if n.HeartbeatInterval == 0 {
+		n.HeartbeatInterval = DefaultHeartbeatInterval
+	}
+	if n.LeaderTimeout == 0 {
+		n.LeaderTimeout = DefaultLeaderTimeout
+	}
+	if n.SendTimeout == 0 {
+		n.SendTimeout = DefaultSendTimeout
+	}
+	if n.Log == nil {
+		n.Log = &log.Logger
+	}
+}
+
+func (n *Node) validateConfig() error {
+	if n.Transport == nil {
+		return fmt.Errorf("no transport provided")
+	}
+	seen := map[int]bool{}
+	for _, id := range n.Ring {
+		if seen[id] {
+			return fmt.Errorf("node %d is twice in the ring", id)
+		}
+		seen[id] = true
+	}
+	if !seen[n.ID()] {
+		return fmt.Errorf("node %d is not in the ring", n.ID())
+	}
+	if n.SendTimeout <= 0 {
+		return fmt.Errorf("send timeout must be positive")
+	}
+	if n.HeartbeatInterval <= 0 || n.LeaderTimeout <= n.HeartbeatInterval {
+		return fmt.Errorf("timeouts must verify 0 < heartbeat interval < leader timeout")
+	}
+	return nil
+}
+
+// ID returns the identifier of the node
+func (n *Node) ID() int {
+	return n.Transport.ID()
+}
+
+// Leader returns the identifier of the leader known by the node, false if the node does not know it
+func (n *Node) Leader() (int, bool) {
+	return n.leader.Get()
+}
+
+// Stats returns the numbers of messages the node delivered to its successors. It is safe to call it from any goroutine
+func (n *Node) Stats() Stats {
+	return Stats{
+		ElectionMessages: n.electionMessages.Load(),
+		ElectedMessages:  n.electedMessages.Load(),
+	}
+}
+
+// Run takes part in the election until ctx is done or the transport is closed
+// the node starts an election right away, before it reads any message
+// it blocks the calling goroutine and returns an error when the configuration is invalid or the transport is closed
+func (n *Node) Run(ctx context.Context) error {
+	n.defaultConfig()
+	err := n.validateConfig()
+	if err != nil {
+		return err
+	}
+	defer leadership.Start(&n.Loop, ctx)()
+	defer n.leader.Set(0, false)
+	n.timer = time.NewTimer(n.LeaderTimeout)
+	defer n.timer.Stop()
+	n.outbox, n.pending = nil, make(chan struct{}, 1)
+	go n.deliverMessages()
+	n.startElection()
+	for {
+		select {
+		case <-n.Ctx.Done():
+			n.Log.Info().Msg("Context cancelled. Exiting")
+			return nil
+		case msg, ok := <-n.Transport.Messages():
+			if !ok {
+				n.Log.Info().Msg("Transport closed. Exiting")
+				return transport.ErrClosed
+			}
+			n.handle(msg)
+		case <-n.timer.C:
+			if n.IsLeader() {
+				n.announce()
+				continue
+			}
+			leader, known := n.Leader()
+			if known {
+				n.Log.Info().Msgf("Leader %d timed out, starting an election", leader)
+			}
+			n.startElection()
+		}
+	}
+}
+
+// startElection sends the node as a candidate to its successor
+func (n *Node) startElection() {
+	n.leader.Set(0, false)
+	leadership.SetState(&n.Loop, election.Candidate)
+	n.participant = true
+	n.forward(electionMessage, payload{Candidate: n.ID(), Term: n.term})
+	peers.ResetTimer(n.timer, n.LeaderTimeout)
+}
+
+// announce sends the node as the leader around the ring
+func (n *Node) announce() {
+	n.forward(electedMessage, payload{Candidate: n.ID(), Term: n.term})
+	peers.ResetTimer(n.timer, n.HeartbeatInterval)
+}
+
+// handle processes a message from the predecessor
+func (n *Node) handle(msg transport.Message) {
+	var content payload
+	err := msg.Decode(&content)
+	if err != nil {
+		n.Log.Info().Err(err).Msgf("Ignoring invalid %s message from node %d", msg.Kind, msg.From)
+		return
+	}
+	if content.Term > n.term {
+		n.term = content.Term
+	}
+	// a message that went around the ring without being stopped belongs to a node that is gone
+	if content.Hops > len(n.Ring) {
+		return
+	}
+	content.Hops++
+	switch msg.Kind {
+	case electionMessage:
+		n.handleElection(content)
+	case electedMessage:
+		n.handleElected(content)
+	}
+}
+
+// handleElection forwards the higher candidates, replaces the lower ones by the node and elects the node when its own candidacy came back
+func (n *Node) handleElection(content payload) {
+	switch {
+	case content.Candidate > n.ID():
+		n.participant = true
+		n.forward(electionMessage, content)
+	case content.Candidate < n.ID():
+		// a participant already sent a candidate at least as high as this one, and a leader keeps announcing itself to the lower nodes
+		if n.participant || n.IsLeader() {
+			return
+		}
+		n.participant = true
+		n.forward(electionMessage, payload{Candidate: n.ID(), Term: n.term})
+	default:
+		// the candidacy went around the ring, so the node has the highest identifier
+		if n.IsLeader() {
+			return
+		}
+		n.participant = false
+		n.term++
+		n.leader.Set(n.ID(), true)
+		n.Log.Info().Msg("Candidacy went around the ring, taking the leadership")
+		leadership.Lead(&n.Loop, n.term)
+		n.announce()
+	}
+}
+
+// handleElected follows the announced leader, or starts an election if the node is higher than it
+func (n *Node) handleElected(content payload) {
+	if content.Candidate == n.ID() {
+		// the announcement went around the ring
+		return
+	}
+	if content.Candidate < n.ID() {
+		// a lower leader was elected while the node was away or partitioned, its announcement stops here
+		// a leader keeps announcing itself until the lower one follows it
+		if !n.participant && !n.IsLeader() {
+			n.Log.Info().Msgf("Node %d is the leader but this node is higher, starting an election", content.Candidate)
+			n.startElection()
+		}
+		return
+	}
+	current, known := n.Leader()
+	if known && current > content.Candidate {
+		// the announcement of a former leader that is still going around
+		return
+	}
+	if !known || current != content.Candidate {
+		n.Log.Info().Msgf("Following node %d", content.Candidate)
+	}
+	n.participant = false
+	n.leader.Set(content.Candidate, true)
+	leadership.SetState(&n.Loop, election.Follower)
+	peers.ResetTimer(n.timer, n.LeaderTimeout)
+	n.forward(electedMessage, content)
+}
+
+// forward queues the message for the successor
+func (n *Node) forward(kind string, content payload) {
+	msg, err := transport.NewMessage(kind, content)
+	if err != nil {
+		n.Log.Info().Err(err).Msgf("Failed to encode the %s message", kind)
+		return
+	}
+	n.outboxMu.Lock()
+	n.outbox = append(n.outbox, msg)
+	n.outboxMu.Unlock()
+	select {
+	case n.pending <- struct{}{}:
+	default:
+	}
+}
+
+// deliverMessages delivers the queued messages in order until the election loop exits
+// the outbox is unbounded so that the election loop never blocks on a slow successor
+func (n *Node) deliverMessages() {
+	for {
+		select {
+		case <-n.Ctx.Done():
+			return
+		case <-n.pending:
+		}
+		for {
+			n.outboxMu.Lock()
+			if len(n.outbox) == 0 {
+				n.outboxMu.Unlock()
+				break
+			}
+			msg := n.outbox[0]
+			n.outbox = n.outbox[1:]
+			n.outboxMu.Unlock()
+			n.deliver(msg)
+		}
+	}
+}
+
+// deliver sends the message to the first successor that can be reached
+// when none can be reached the message comes back to the node itself, which is then alone in the ring
+// the failures are left to the leader timeout
+func (n *Node) deliver(msg transport.Message) {
+	for _, successor := range n.successors() {
+		ctx, cancel := context.WithTimeout(n.Ctx, n.SendTimeout)
+		err := n.Transport.Send(ctx, successor, msg)
+		cancel()
+		if err == nil {
+			n.count(msg.Kind)
+			return
+		}
+		if errors.Is(err, transport.ErrClosed) || n.Ctx.Err() != nil {
+			return
+		}
+		n.Log.Debug().Err(err).Msgf("Skipping unreachable node %d", successor)
+	}
+}
+
+// successors returns the nodes in the order of the ring, starting from the successor of the node and ending with the node itself
+func (n *Node) successors() []int {
+	position := 0
+	for i, id := range n.Ring {
+		if id == n.ID() {
+			position = i
+		}
+	}
+	successors := make([]int, 0, len(n.Ring))
+	for i := 1; i <= len(n.Ring); i++ {
+		successors = append(successors, n.Ring[(position+i)%len(n.Ring)])
+	}
+	return successors
+}
+
+// count counts a message delivered to a successor
+func (n *Node) count(kind string) {
+	switch kind {
+	case electionMessage:
+		n.electionMessages.Add(1)
+	case electedMessage:
+		n.electedMessages.Add(1)
+	}
+}
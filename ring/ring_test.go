@@ -0,0 +1,132 @@
+package ring_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/election"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/internal/peertest"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/ring"
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/transport"
+)
+
+var _ = Describe("Ring election on an in-memory network", func() {
+	var (
+		ctx       context.Context
+		cancel    context.CancelFunc
+		cluster   *peertest.Cluster[*ring.Node]
+		heartbeat time.Duration
+		// order is the ring the nodes are given
+		order []int
+	)
+
+	// sum returns a function that sums the stats of the nodes
+	sum := func() func() ring.Stats {
+		return func() ring.Stats {
+			var total ring.Stats
+			for _, node := range cluster.Nodes {
+				stats := node.Stats()
+				total.ElectionMessages += stats.ElectionMessages
+				total.ElectedMessages += stats.ElectedMessages
+			}
+			return total
+		}
+	}
+
+	BeforeEach(func() {
+		heartbeat = 50 * time.Millisecond
+		ctx, cancel = context.WithCancel(context.Background())
+		cluster = peertest.NewCluster(ctx, func(memory transport.Transport) *ring.Node {
+			return &ring.Node{
+				Transport:         memory,
+				Ring:              order,
+				HeartbeatInterval: heartbeat,
+				LeaderTimeout:     5 * heartbeat,
+				SendTimeout:       100 * time.Millisecond,
+			}
+		})
+	})
+	AfterEach(func() {
+		cancel()
+		cluster.Close()
+	})
+
+	Describe("Message complexity", func() {
+		BeforeEach(func() {
+			// no heartbeat or timeout must fire while the messages are counted
+			heartbeat = 2 * time.Second
+		})
+
+		It("must elect the highest node with 2n-1 election messages when the ring goes up", func() {
+			order = []int{1, 2, 3, 4, 5}
+			cluster.Start(1, 2, 3, 4, 5)
+			cluster.ExpectLeader(5)
+			// every candidacy but the highest one is swallowed by its successor, the highest one goes around the ring
+			Eventually(sum()).Should(Equal(ring.Stats{ElectionMessages: 9, ElectedMessages: 5}))
+			Consistently(sum(), 200*time.Millisecond).Should(Equal(ring.Stats{ElectionMessages: 9, ElectedMessages: 5}))
+		})
+
+		It("must elect the highest node with n(n+1)/2 election messages when the ring goes down", func() {
+			order = []int{5, 4, 3, 2, 1}
+			cluster.Start(1, 2, 3, 4, 5)
+			cluster.ExpectLeader(5)
+			// every candidacy travels down to the highest node
+			Eventually(sum()).Should(Equal(ring.Stats{ElectionMessages: 15, ElectedMessages: 5}))
+		})
+	})
+
+	It("must elect the next highest node with a bigger token when the leader crashes", func() {
+		order = []int{3, 1, 5, 2, 4}
+		cluster.Start(1, 2, 3, 4, 5)
+		cluster.ExpectLeader(5)
+		firstToken, ok := cluster.Nodes[5].FencingToken()
+		Expect(ok).To(BeTrue())
+		cluster.Crash(5)
+		cluster.ExpectLeader(4)
+		secondToken, ok := cluster.Nodes[4].FencingToken()
+		Expect(ok).To(BeTrue())
+		Expect(secondToken).To(BeNumerically(">", firstToken))
+	})
+
+	It("must skip a member that crashed and keep the leader", func() {
+		order = []int{1, 2, 3, 4, 5}
+		cluster.Start(1, 2, 3, 4, 5)
+		cluster.ExpectLeader(5)
+		elected := cluster.Nodes[4].Stats().ElectedMessages
+		cluster.Crash(3)
+		// the heartbeats of the leader still go around the ring through the successor of the crashed node
+		Consistently(peertest.LeaderOf(cluster.Nodes[4]), 500*time.Millisecond).Should(Equal(5))
+		Expect(cluster.Nodes[4].Stats().ElectedMessages).To(BeNumerically(">", elected))
+		for _, node := range cluster.Nodes {
+			Expect(node.State()).NotTo(Equal(election.Candidate))
+		}
+	})
+
+	It("must hand the leadership to a higher node that joins the ring", func() {
+		order = []int{1, 2, 3, 4, 5}
+		// the node that is not up yet is not on the network, so the others skip it
+		cluster.Start(1, 2, 3, 4)
+		cluster.ExpectLeader(4)
+		cluster.Start(5)
+		cluster.ExpectLeader(5)
+	})
+
+	It("must become the leader when it is alone in the ring", func() {
+		order = []int{1}
+		cluster.Start(1)
+		Expect(cluster.Nodes[1].WaitForLeadership(ctx)).To(Succeed())
+		Expect(peertest.LeaderOf(cluster.Nodes[1])()).To(Equal(1))
+	})
+
+	It("must refuse a ring that does not contain the node once", func() {
+		order = []int{1, 2}
+		cluster.Join(1)
+		cluster.Nodes[1].Ring = []int{2, 3}
+		Expect(cluster.Nodes[1].Run(ctx)).NotTo(Succeed())
+		cluster.Nodes[1].Ring = []int{1, 2, 1}
+		Expect(cluster.Nodes[1].Run(ctx)).NotTo(Succeed())
+	})
+})
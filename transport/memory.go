@@ -0,0 +1,153 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// inboxSize is the number of messages a node of the in-memory network can hold before the senders block
+const inboxSize = 64
+
+// Network is an in-memory network for tests
+// the nodes join it with Join, crash by closing their transport, and can be partitioned from each other
+type Network struct {
+	// mu protects nodes and groups
+	mu sync.Mutex
+	// nodes are the transports of the nodes that have not been closed, indexed by identifier
+	nodes map[int]*Memory
+	// groups is the group of every node listed in the current partition, the nodes that are not listed are in the group 0
+	// nodes of different groups cannot reach each other. it is nil when the network is healed
+	groups map[int]int
+}
+
+// NewNetwork returns an empty network
+func NewNetwork() *Network {
+	return &Network{nodes: map[int]*Memory{}}
+}
+
+// Join attaches a node to the network and returns its transport
+// a node that has closed its transport can join again, it returns an error if the node is already attached
+func (n *Network) Join(id int) (*Memory, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if _, ok := n.nodes[id]; ok {
+		return nil, fmt.Errorf("node %d already joined the network", id)
+	}
+	node := &Memory{
+		network: n,
+		id:      id,
+		inbox:   make(chan Message, inboxSize),
+		done:    make(chan struct{}),
+	}
+	n.nodes[id] = node
+	return node, nil
+}
+
+// Partition splits the network in groups that cannot reach each other
+// every argument is a group of nodes, the nodes that are not listed form one more group together
+func (n *Network) Partition(groups ...[]int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.groups = map[int]int{}
+	for i, group := range groups {
+		for _, id := range group {
+			n.groups[id] = i + 1
+		}
+	}
+}
+
+// Heal removes the partition, every node can reach every other node again
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.groups = nil
+}
+
+// peer returns the transport of the node if it can be reached from the sender
+func (n *Network) peer(from, to int) (*Memory, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	node, ok := n.nodes[to]
+	if !ok || n.groups[from] != n.groups[to] {
+		return nil, false
+	}
+	return node, true
+}
+
+// leave detaches the node from the network
+func (n *Network) leave(node *Memory) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.nodes[node.id] == node {
+		delete(n.nodes, node.id)
+	}
+}
+
+// Memory is the transport of a node of an in-memory network
+type Memory struct {
+	network *Network
+	id      int
+	// mu is held for reading by the senders while they deliver to this node and for writing when its inbox is closed
+	mu     sync.RWMutex
+	closed bool
+	inbox  chan Message
+	// done is closed first when the transport is closed, to unblock the senders
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// ID returns the identifier of the node
+func (m *Memory) ID() int {
+	return m.id
+}
+
+// Send delivers the message to the inbox of the peer, it blocks while the inbox is full
+func (m *Memory) Send(ctx context.Context, to int, msg Message) error {
+	select {
+	case <-m.done:
+		return ErrClosed
+	default:
+	}
+	peer, ok := m.network.peer(m.id, to)
+	if !ok {
+		return ErrUnreachable
+	}
+	msg.From = m.id
+	return peer.deliver(ctx, msg)
+}
+
+// deliver puts the message in the inbox of the node
+func (m *Memory) deliver(ctx context.Context, msg Message) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return ErrUnreachable
+	}
+	select {
+	case m.inbox <- msg:
+		return nil
+	case <-m.done:
+		return ErrUnreachable
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Messages returns the inbox of the node
+func (m *Memory) Messages() <-chan Message {
+	return m.inbox
+}
+
+// Close detaches the node from the network as if it crashed, the messages it has not read are lost
+func (m *Memory) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.done)
+		m.network.leave(m)
+		m.mu.Lock()
+		m.closed = true
+		close(m.inbox)
+		m.mu.Unlock()
+	})
+	return nil
+}
@@ -0,0 +1,234 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultDialTimeout is the dial timeout used by the TCP transport when DialTimeout is not set
+const DefaultDialTimeout = time.Second
+
+// TCPConfig is the configuration of a TCP transport
+type TCPConfig struct {
+	// ID is the identifier of the node
+	ID int
+	// Peers are the addresses of the nodes indexed by identifier, it may include the node itself so that every node shares the same map
+	Peers map[int]string
+	// Address is the address the node listens on. The default value is the address of the node in Peers
+	Address string
+	// DialTimeout is the timeout to connect to a peer. The default value is DefaultDialTimeout
+	DialTimeout time.Duration
+}
+
+// TCP is a transport that sends the messages as JSON over one TCP connection per peer
+// the connections are opened on the first message and opened again after a failure
+type TCP struct {
+	config   TCPConfig
+	listener net.Listener
+	inbox    chan Message
+	// mu protects outgoing and incoming
+	mu sync.Mutex
+	// outgoing are the connections to the peers, indexed by identifier
+	outgoing map[int]*tcpConn
+	// incoming are the connections accepted from the peers
+	incoming map[net.Conn]struct{}
+	// readers tracks the goroutines that accept and read the connections
+	readers   sync.WaitGroup
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// tcpConn is a connection to a peer
+type tcpConn struct {
+	// mu serializes the messages written to the connection
+	mu      sync.Mutex
+	conn    net.Conn
+	encoder *json.Encoder
+}
+
+// NewTCP listens on the address of the node and returns its transport
+func NewTCP(config TCPConfig) (*TCP, error) {
+	if config.Address == "" {
+		config.Address = config.Peers[config.ID]
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("no address provided for node %d", config.ID)
+	}
+	if config.DialTimeout == 0 {
+		config.DialTimeout = DefaultDialTimeout
+	}
+	listener, err := net.Listen("tcp", config.Address)
+	if err != nil {
+		return nil, err
+	}
+	t := &TCP{
+		config:   config,
+		listener: listener,
+		inbox:    make(chan Message, inboxSize),
+		outgoing: map[int]*tcpConn{},
+		incoming: map[net.Conn]struct{}{},
+		done:     make(chan struct{}),
+	}
+	t.readers.Add(1)
+	go t.accept()
+	return t, nil
+}
+
+// ID returns the identifier of the node
+func (t *TCP) ID() int {
+	return t.config.ID
+}
+
+// Addr returns the address the node listens on
+func (t *TCP) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// accept reads the connections opened by the peers until the transport is closed
+func (t *TCP) accept() {
+	defer t.readers.Done()
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.mu.Lock()
+		select {
+		case <-t.done:
+			t.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		t.incoming[conn] = struct{}{}
+		t.readers.Add(1)
+		t.mu.Unlock()
+		go t.read(conn)
+	}
+}
+
+// read decodes the messages of a peer until the connection or the transport is closed
+func (t *TCP) read(conn net.Conn) {
+	defer t.readers.Done()
+	defer func() {
+		t.mu.Lock()
+		delete(t.incoming, conn)
+		t.mu.Unlock()
+		conn.Close()
+	}()
+	decoder := json.NewDecoder(conn)
+	for {
+		var msg Message
+		err := decoder.Decode(&msg)
+		if err != nil {
+			return
+		}
+		select {
+		case t.inbox <- msg:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Send writes the message on the connection to the peer, it opens the connection if needed
+// the connection is dropped on failure so that the next message opens a new one
+func (t *TCP) Send(ctx context.Context, to int, msg Message) error {
+	select {
+	case <-t.done:
+		return ErrClosed
+	default:
+	}
+	peer, err := t.connection(ctx, to)
+	if err != nil {
+		return err
+	}
+	msg.From = t.config.ID
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Time{}
+	}
+	peer.conn.SetWriteDeadline(deadline)
+	err = peer.encoder.Encode(msg)
+	if err != nil {
+		t.drop(to, peer)
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	return nil
+}
+
+// connection returns the connection to the peer, it dials it if there is none
+func (t *TCP) connection(ctx context.Context, to int) (*tcpConn, error) {
+	address, ok := t.config.Peers[to]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown node %d", ErrUnreachable, to)
+	}
+	t.mu.Lock()
+	peer, ok := t.outgoing[to]
+	t.mu.Unlock()
+	if ok {
+		return peer, nil
+	}
+	dialer := net.Dialer{Timeout: t.config.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	select {
+	case <-t.done:
+		conn.Close()
+		return nil, ErrClosed
+	default:
+	}
+	// another message may have opened a connection in the meantime
+	if peer, ok := t.outgoing[to]; ok {
+		conn.Close()
+		return peer, nil
+	}
+	peer = &tcpConn{conn: conn, encoder: json.NewEncoder(conn)}
+	t.outgoing[to] = peer
+	return peer, nil
+}
+
+// drop closes the connection to the peer and forgets it
+func (t *TCP) drop(to int, peer *tcpConn) {
+	peer.conn.Close()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.outgoing[to] == peer {
+		delete(t.outgoing, to)
+	}
+}
+
+// Messages returns the channel of the messages received from the peers
+func (t *TCP) Messages() <-chan Message {
+	return t.inbox
+}
+
+// Close stops listening, closes every connection and then the channel of the messages
+func (t *TCP) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		close(t.done)
+		err = t.listener.Close()
+		for _, peer := range t.outgoing {
+			peer.conn.Close()
+		}
+		for conn := range t.incoming {
+			conn.Close()
+		}
+		t.mu.Unlock()
+		t.readers.Wait()
+		close(t.inbox)
+	})
+	return err
+}
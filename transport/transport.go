@@ -0,0 +1,54 @@
+// Package transport carries the messages of the peer to peer elections of this module
+// it ships a TCP transport for real deployments and an in-memory network for tests, which can crash nodes and partition them
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+var (
+	// ErrUnreachable is returned by Send when the peer cannot be reached, because it is down, unknown or partitioned away
+	ErrUnreachable = errors.New("peer unreachable")
+	// ErrClosed is returned by Send once the transport is closed
+	ErrClosed = errors.New("transport closed")
+)
+
+// Message is a message exchanged between two nodes
+type Message struct {
+	// From is the identifier of the sender, it is set by the transport
+	From int `json:"from"`
+	// Kind is the kind of the message, its meaning is up to the algorithm
+	Kind string `json:"kind"`
+	// Payload is the content of the message, encoded by the algorithm
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Transport sends messages to the peers of a node and receives theirs
+// the nodes are identified by integers, which the elections also use to rank them
+type Transport interface {
+	// ID returns the identifier of the node
+	ID() int
+	// Send delivers the message to the peer, it returns ErrUnreachable if the peer cannot be reached
+	// a nil error does not mean that the peer processed the message, only that it was handed over to it
+	Send(ctx context.Context, to int, msg Message) error
+	// Messages returns the channel on which the messages of the peers are received, it is closed when the transport is closed
+	Messages() <-chan Message
+	// Close stops the transport, it is safe to call it several times
+	Close() error
+}
+
+// NewMessage returns a message of the given kind with the payload encoded as JSON
+func NewMessage(kind string, payload interface{}) (Message, error) {
+	content, err := json.Marshal(payload)
+	if err != nil {
+		return Message{}, err
+	}
+	return Message{Kind: kind, Payload: content}, nil
+}
+
+// Decode decodes the payload of the message into v
+func (m Message) Decode(v interface{}) error {
+	return json.Unmarshal(m.Payload, v)
+}
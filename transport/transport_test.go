@@ -0,0 +1,172 @@
+package transport_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"gitlab.mobile-intra.com/cloud-ops/distributed-algorithms/transport"
+)
+
+// ping is the payload of the messages of the specs
+type ping struct {
+	Sequence int `json:"sequence"`
+}
+
+// send sends a ping with the given sequence
+func send(from transport.Transport, to, sequence int) error {
+	msg, err := transport.NewMessage("ping", ping{Sequence: sequence})
+	Expect(err).To(BeNil())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return from.Send(ctx, to, msg)
+}
+
+// receivePing expects the next message of the node to be a ping from the sender with the given sequence
+func receivePing(node transport.Transport, from, sequence int) {
+	var msg transport.Message
+	Eventually(node.Messages()).Should(Receive(&msg))
+	Expect(msg.From).To(Equal(from))
+	Expect(msg.Kind).To(Equal("ping"))
+	var payload ping
+	Expect(msg.Decode(&payload)).To(Succeed())
+	Expect(payload.Sequence).To(Equal(sequence))
+}
+
+var _ = Describe("In-memory network", func() {
+	var (
+		network *transport.Network
+		nodes   []*transport.Memory
+	)
+
+	BeforeEach(func() {
+		network = transport.NewNetwork()
+		nodes = nil
+		for id := 1; id <= 3; id++ {
+			node, err := network.Join(id)
+			Expect(err).To(BeNil())
+			nodes = append(nodes, node)
+		}
+	})
+	AfterEach(func() {
+		for _, node := range nodes {
+			node.Close()
+		}
+	})
+
+	It("must deliver the messages in order with the identifier of the sender", func() {
+		Expect(send(nodes[0], 2, 1)).To(Succeed())
+		Expect(send(nodes[0], 2, 2)).To(Succeed())
+		receivePing(nodes[1], 1, 1)
+		receivePing(nodes[1], 1, 2)
+	})
+
+	It("must not deliver the messages across a partition until it is healed", func() {
+		network.Partition([]int{1})
+		Expect(send(nodes[0], 2, 1)).To(MatchError(transport.ErrUnreachable))
+		Expect(send(nodes[2], 1, 1)).To(MatchError(transport.ErrUnreachable))
+		Expect(send(nodes[1], 3, 1)).To(Succeed())
+		receivePing(nodes[2], 2, 1)
+		network.Heal()
+		Expect(send(nodes[0], 2, 2)).To(Succeed())
+		receivePing(nodes[1], 1, 2)
+	})
+
+	It("must make a closed node unreachable until it joins again", func() {
+		Expect(nodes[1].Close()).To(Succeed())
+		Eventually(nodes[1].Messages()).Should(BeClosed())
+		Expect(send(nodes[0], 2, 1)).To(MatchError(transport.ErrUnreachable))
+		Expect(send(nodes[1], 1, 1)).To(MatchError(transport.ErrClosed))
+		_, err := network.Join(1)
+		Expect(err).NotTo(BeNil())
+		restarted, err := network.Join(2)
+		Expect(err).To(BeNil())
+		nodes = append(nodes, restarted)
+		Expect(send(nodes[0], 2, 2)).To(Succeed())
+		receivePing(restarted, 1, 2)
+	})
+
+	It("must unblock a sender waiting on a full inbox when the peer crashes", func() {
+		sent := make(chan error)
+		go func() {
+			defer GinkgoRecover()
+			for sequence := 0; ; sequence++ {
+				err := send(nodes[0], 2, sequence)
+				if err != nil {
+					sent <- err
+					return
+				}
+			}
+		}()
+		Consistently(sent, 100*time.Millisecond).ShouldNot(Receive())
+		nodes[1].Close()
+		Eventually(sent).Should(Receive(MatchError(transport.ErrUnreachable)))
+	})
+})
+
+var _ = Describe("TCP transport", func() {
+	var (
+		peers map[int]string
+		nodes map[int]*transport.TCP
+	)
+
+	// start starts the transport of the node
+	start := func(id int) *transport.TCP {
+		node, err := transport.NewTCP(transport.TCPConfig{ID: id, Peers: peers, DialTimeout: 100 * time.Millisecond})
+		Expect(err).To(BeNil())
+		nodes[id] = node
+		return node
+	}
+
+	BeforeEach(func() {
+		peers = map[int]string{1: freeAddress(), 2: freeAddress()}
+		nodes = map[int]*transport.TCP{}
+	})
+	AfterEach(func() {
+		for _, node := range nodes {
+			node.Close()
+		}
+	})
+
+	It("must deliver the messages in order with the identifier of the sender", func() {
+		first, second := start(1), start(2)
+		Expect(first.Addr().String()).To(Equal(peers[1]))
+		for sequence := 1; sequence <= 3; sequence++ {
+			Expect(send(first, 2, sequence)).To(Succeed())
+		}
+		Expect(send(second, 1, 4)).To(Succeed())
+		for sequence := 1; sequence <= 3; sequence++ {
+			receivePing(second, 1, sequence)
+		}
+		receivePing(first, 2, 4)
+	})
+
+	It("must report a peer that is down or unknown as unreachable", func() {
+		first := start(1)
+		Expect(send(first, 2, 1)).To(MatchError(transport.ErrUnreachable))
+		Expect(send(first, 3, 1)).To(MatchError(transport.ErrUnreachable))
+	})
+
+	It("must reconnect to a peer that restarted", func() {
+		first, second := start(1), start(2)
+		Expect(send(first, 2, 1)).To(Succeed())
+		receivePing(second, 1, 1)
+		Expect(second.Close()).To(Succeed())
+		Eventually(second.Messages()).Should(BeClosed())
+		// the first writes after the restart may still land in the socket buffer of the dead connection
+		Eventually(func() error { return send(first, 2, 2) }).Should(MatchError(transport.ErrUnreachable))
+		second = start(2)
+		Expect(send(first, 2, 3)).To(Succeed())
+		receivePing(second, 1, 3)
+	})
+
+	It("must close the channel of the messages on close", func() {
+		first := start(1)
+		Expect(first.Close()).To(Succeed())
+		Expect(first.Close()).To(Succeed())
+		Eventually(first.Messages()).Should(BeClosed())
+		Expect(send(first, 2, 1)).To(MatchError(transport.ErrClosed))
+	})
+})
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// TLSConfig is the configuration of an encrypted connection to the zookeeper ensemble
+type TLSConfig struct {
+	// CAFile is the path of the PEM bundle of the certificate authorities trusted to sign the server certificates
+	// If it is empty, the system pool is used
+	CAFile string
+	// CertFile is the path of the PEM client certificate. It is only needed if the servers require client authentication
+	CertFile string
+	// KeyFile is the path of the PEM private key of the client certificate
+	KeyFile string
+	// ServerName is the name expected in the server certificates. If it is empty, the host of the server address is used
+	ServerName string
+}
+
+// ClientConfig loads the certificates and returns the tls configuration for the client side of the connection
+func (c *TLSConfig) ClientConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %s", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// Dialer returns the function used by the zookeeper client to open its connections
+// it dials plain TCP if config is nil and TLS otherwise
+func Dialer(config *TLSConfig) (func(network, address string, timeout time.Duration) (net.Conn, error), error) {
+	if config == nil {
+		return net.DialTimeout, nil
+	}
+	clientConfig, err := config.ClientConfig()
+	if err != nil {
+		return nil, err
+	}
+	return func(network, address string, timeout time.Duration) (net.Conn, error) {
+		return tls.DialWithDialer(&net.Dialer{Timeout: timeout}, network, address, clientConfig)
+	}, nil
+}